@@ -0,0 +1,159 @@
+package gumak
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mutex/gumak/formats"
+	"mutex/gumak/log"
+)
+
+// Log of the AY register writes grouped by frames, saved as PSG or YM when
+// the requested number of frames is logged or by StopAyLog.
+
+type AyLogFormat int
+
+const (
+	AyLogPsg AyLogFormat = iota
+	AyLogYm5
+	AyLogYm6
+)
+
+type ayLogger struct {
+	filename string
+	format   AyLogFormat
+	frames   int // Number of frames to log (len(log) when done), 0 until stopped.
+	initial  [formats.YM_REGISTERS]uint8
+	log      [][]formats.AyWrite
+	current  []formats.AyWrite
+	done     bool
+	err      error
+}
+
+// Extension returns file extension of the format.
+func (f AyLogFormat) Extension() string {
+	if f == AyLogPsg {
+		return ".psg"
+	}
+	return ".ym"
+}
+
+// AyLogFormatOf returns format by file extension: '.psg', '.ym' (YM6).
+func AyLogFormatOf(filename string) (AyLogFormat, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".psg":
+		return AyLogPsg, nil
+	case ".ym":
+		return AyLogYm6, nil
+	}
+
+	return 0, fmt.Errorf("Unknown AY log format: %s", filename)
+}
+
+// StartAyLog logs AY register writes of the following frames (0 until
+// StopAyLog) into file. The first frame starts with the current registers.
+func (g *Gumak) StartAyLog(filename string, format AyLogFormat, frames int) error {
+	if g.AyLogging() {
+		return fmt.Errorf("AY logging already running")
+	}
+
+	if format < AyLogPsg || format > AyLogYm6 {
+		return fmt.Errorf("Unknown AY log format %d", format)
+	}
+
+	l := &ayLogger{filename: filename, format: format, frames: frames}
+
+	regs := g.Ay_3_8912.Registers()
+	for reg := uint8(0); reg < 14; reg++ {
+		l.initial[reg] = regs[reg]
+		if reg != 13 {
+			l.current = append(l.current, formats.AyWrite{Reg: reg, Value: regs[reg]})
+		}
+	}
+
+	g.Ay_3_8912.RegisterWrite = l.write
+
+	log.Info("Logging AY to %s", filename)
+	g.ayLog = l
+	return nil
+}
+
+// StopAyLog saves the log if not saved yet, returns error of the saving.
+func (g *Gumak) StopAyLog() error {
+	if g.ayLog == nil {
+		return nil
+	}
+
+	l := g.ayLog
+	g.ayLog = nil
+	g.Ay_3_8912.RegisterWrite = nil
+
+	if !l.done {
+		l.save(g)
+	}
+	return l.err
+}
+
+func (g *Gumak) AyLogging() bool {
+	return g.ayLog != nil && !g.ayLog.done
+}
+
+func (l *ayLogger) write(reg, value uint8) {
+	if !l.done && reg < 14 {
+		l.current = append(l.current, formats.AyWrite{Reg: reg, Value: value})
+	}
+}
+
+func (l *ayLogger) frame(g *Gumak) {
+	if l.done {
+		return
+	}
+
+	l.log = append(l.log, l.current)
+	l.current = nil
+
+	if len(l.log) == l.frames {
+		l.save(g)
+		g.Ay_3_8912.RegisterWrite = nil
+	}
+}
+
+func (l *ayLogger) save(g *Gumak) {
+	l.done = true
+
+	f, err := os.Create(l.filename)
+	if err == nil {
+		switch l.format {
+		case AyLogPsg:
+			err = formats.SavePsg(f, l.log)
+		case AyLogYm5, AyLogYm6:
+			version := formats.YM_VERSION_6
+			if l.format == AyLogYm5 {
+				version = formats.YM_VERSION_5
+			}
+			err = formats.SaveYm(f, &formats.YmSong{
+				Version: version,
+				Clock:   uint32(g.Machine.Frequency / 2),
+				Rate:    uint16(math.Round(g.FrameRate())),
+				Name:    filepath.Base(l.filename),
+				Comment: "Logged by Gumak, " + g.Model,
+				Frames:  formats.YmFrames(l.initial, l.log),
+			})
+		}
+
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+
+	if err != nil {
+		log.Error("Failed to save AY log %s: %s", l.filename, err)
+		l.err = err
+		return
+	}
+
+	log.Info("Saved AY log %s (%d frames)", l.filename, len(l.log))
+}
@@ -1,23 +1,84 @@
 package device
 
 import (
-	"math"
 	"mutex/gumak/helpers"
 )
 
+// AY-3-8912 emulated from its counters. The chip runs at CPU clock / 2
+// (1.7734 MHz on 128K), all generators are stepped every 8 clocks:
+//
+//	Generator  Period registers   Output
+//	Tone       R0-R5 (12 bits)    square wave, flips every period steps
+//	Noise      R6 (5 bits)        17-bit LFSR, shifts every 2*period steps
+//	Envelope   R11-R12 (16 bits)  32 levels, next level every period steps
+//
+// The AY envelope has 16 levels, its level is the upper 4 bits of the 32
+// level YM2149 envelope. Output of the steps is averaged over the output
+// sample.
+
+const (
+	AY_STEP_CLOCKS = 8
+	AY_NOISE_BITS  = 17
+)
+
 type Channel struct {
-	freq       float64
-	onOff      bool
+	period  uint16
+	counter uint16
+	tone    uint8 // 0, 1
+
+	toneOff    bool // Mixer R7, disabled generator outputs 1.
+	noiseOff   bool
 	volume     uint8 // 0 - 15
 	autoVolume bool
-	noiseOn    bool
 }
 
 type Envelope struct {
-	freq  float64
-	shape uint8
-	time  float64
-	cycle float64
+	period  uint16
+	counter uint16
+	shape   uint8
+	segment int
+	level   int // 0 - 31
+}
+
+type envelopeSegment int
+
+const (
+	envelopeDown envelopeSegment = iota
+	envelopeUp
+	envelopeHoldBottom
+	envelopeHoldTop
+)
+
+// Shapes as the first segment and the second and third one, which then
+// alternate:
+//
+//	0-3  \___   8  \\\\   12  ////
+//	4-7  /___   9  \___   13  /^^^
+//	            10 \/\/   14  /\/\
+//	            11 \^^^   15  /___
+var envelopeShapes = [16][3]envelopeSegment{
+	{envelopeDown, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeDown, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeDown, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeDown, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeUp, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeUp, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeUp, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeUp, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeDown, envelopeDown, envelopeDown},
+	{envelopeDown, envelopeHoldBottom, envelopeHoldBottom},
+	{envelopeDown, envelopeUp, envelopeDown},
+	{envelopeDown, envelopeHoldTop, envelopeHoldTop},
+	{envelopeUp, envelopeUp, envelopeUp},
+	{envelopeUp, envelopeHoldTop, envelopeHoldTop},
+	{envelopeUp, envelopeDown, envelopeUp},
+	{envelopeUp, envelopeHoldBottom, envelopeHoldBottom},
+}
+
+type Noise struct {
+	period  uint8
+	counter uint8
+	lfsr    uint32
 }
 
 type AY_3_8912 struct {
@@ -25,42 +86,30 @@ type AY_3_8912 struct {
 
 	regs [15]uint8
 
-	noiseFreq float64
-
 	channelA Channel
 	channelB Channel
 	channelC Channel
 
-	env Envelope
+	noise Noise
+	env   Envelope
 
-	time float64
+	// Time since the last sample, register writes take effect at this
+	// time. Without it they take effect at the start of the next sample.
+	Elapsed func() float64
 
-	dc      Dc
+	// Optional hook called on every register write from the bus.
+	RegisterWrite func(reg, value uint8)
+
+	stepTime float64    // Duration of a step in seconds.
+	time     float64    // Time emulated since the last sample.
+	sum      [3]float64 // Sum of channel outputs since the last sample.
+	steps    int
+	output   [3]float64 // Channel outputs of the last step.
+
+	dc      [3]Dc
 	dcIndex int
 }
 
-/*
-// D/C table, taken from AY-3-8912 manual.
-var Volumes = []float64{
-	0,
-	0,
-	0,
-	0,
-	0,
-	0,
-	0,
-	0,
-	0,
-	0.125,
-	0.1515,
-	0.25,
-	0.303,
-	0.5,
-	0.707,
-	1,
-}
-*/
-
 // D/C table.
 // src: https://github.com/true-grue/ayumi/blob/master/ayumi.c
 // Manual contains only couple of values...
@@ -85,101 +134,135 @@ var Volumes = []float64{
 
 // Envelope
 
-func (e *Envelope) Update(timeDelta float64) uint8 {
-
-	e.time += timeDelta
-	cycle, fract := math.Modf(e.freq * e.time)
+// Step advances the envelope by one step (8 AY clocks).
+func (e *Envelope) Step() {
+	e.counter++
+	if e.counter < e.period {
+		return
+	}
+	e.counter = 0
 
-	if cycle > 0 {
-		// Cont.
-		if (e.shape & 0b0001) == 0 {
-			return 0
+	switch envelopeShapes[e.shape][e.segment] {
+	case envelopeDown:
+		if e.level > 0 {
+			e.level--
+			return
 		}
-
-		// Hold
-		if (e.shape & 0b1000) != 0 {
-			b1, b2 := (e.shape&0b0010)>>1, (e.shape&0b0100)>>2
-			if (b1 ^ b2) == 0 {
-				return 0
-			} else {
-				return 1
-			}
+	case envelopeUp:
+		if e.level < 31 {
+			e.level++
+			return
 		}
+	default:
+		return
 	}
 
-	// Alternate
-	if (e.shape&0b0100) != 0 && cycle != e.cycle {
-		e.shape ^= 0b0010
+	// End of the segment, the second and the third one alternate.
+	if e.segment == 1 {
+		e.segment = 2
+	} else {
+		e.segment = 1
 	}
+	e.startSegment()
+}
 
-	e.cycle = cycle
-
-	// Dir (1 up, 0 down)
-	if (e.shape & 0b0010) == 0 {
-		fract = 0.999999 - fract
+func (e *Envelope) startSegment() {
+	switch envelopeShapes[e.shape][e.segment] {
+	case envelopeDown, envelopeHoldTop:
+		e.level = 31
+	case envelopeUp, envelopeHoldBottom:
+		e.level = 0
 	}
+}
 
-	return uint8(16 * fract)
+// Level of the 32 step (YM2149) envelope.
+func (e *Envelope) Level() uint8 {
+	return uint8(e.level)
 }
 
-func (e *Envelope) SetFreq(freq uint16) {
-	e.time = 0
-	e.cycle = 0
-	e.freq = (1789772.5 / (256 * float64(freq)))
+// Level of the 16 step (AY-3-8912) envelope.
+func (e *Envelope) AyLevel() uint8 {
+	return uint8(e.level >> 1)
 }
 
+func (e *Envelope) SetPeriod(period uint16) {
+	if period == 0 {
+		period = 1
+	}
+	e.period = period
+}
+
+// SetShape restarts the envelope.
 func (e *Envelope) SetShape(shape uint8) {
-	e.time = 0
-	e.cycle = 0
-	e.shape = shape
+	e.shape = shape & 0b1111
+	e.counter = 0
+	e.segment = 0
+	e.startSegment()
 }
 
-// Channel
-func (t *Channel) Volume(env uint8) float64 {
-	if t.autoVolume {
-		return Volumes[env]
-	} else {
-		return Volumes[t.volume]
-	}
+// Noise
+
+func (n *Noise) Reset() {
+	n.counter = 0
+	n.lfsr = 1
 }
 
-func (t *Channel) Noise(noise float64) float64 {
-	if t.noiseOn {
-		return noise
-	} else {
-		return 0
+// Step advances the noise by one step (8 AY clocks).
+func (n *Noise) Step() {
+	n.counter++
+	if n.counter < 2*n.period {
+		return
 	}
+	n.counter = 0
+
+	bit := (n.lfsr ^ (n.lfsr >> 3)) & 1
+	n.lfsr = (n.lfsr >> 1) | (bit << (AY_NOISE_BITS - 1))
 }
 
-func (t *Channel) Tone(time float64) float64 {
-	if !t.onOff {
-		return 0
+func (n *Noise) Output() uint8 {
+	return uint8(n.lfsr & 1)
+}
+
+func (n *Noise) SetPeriod(period uint8) {
+	if period == 0 {
+		period = 1
 	}
+	n.period = period
+}
 
-	// Square wave from sine harmonics.
-	// https://www.youtube.com/watch?v=72dI7dB3ZvQ&t=1s
-	p := math.Pi
+// Channel
 
-	freqTime := t.freq * 2. * math.Pi * time
+// Step advances the tone by one step (8 AY clocks).
+func (t *Channel) Step() {
+	t.counter++
+	if t.counter >= t.period {
+		t.counter = 0
+		t.tone ^= 1
+	}
+}
 
-	a := 0.0
-	b := 0.0
-	c := 0.0
-	for n := 1.; n < 20; n++ {
-		c += freqTime
-		a += -helpers.Approxsin(c) / n
-		b += -helpers.Approxsin(c-p*n) / n
+// Output of the mixer, disabled tone or noise output 1.
+func (t *Channel) Output(noise uint8, env uint8) float64 {
+	if (t.tone == 0 && !t.toneOff) || (noise == 0 && !t.noiseOff) {
+		return 0
 	}
 
-	return (2 / math.Pi) * (a - b)
+	return t.Volume(env)
 }
 
-func (t *Channel) SetFreq(freq uint16) {
-	if freq == 0 {
-		freq = 1
+func (t *Channel) Volume(env uint8) float64 {
+	if t.autoVolume {
+		return Volumes[env]
+	} else {
+		return Volumes[t.volume]
 	}
+}
 
-	t.freq = 1789772.5 / (16 * float64(freq))
+func (t *Channel) SetPeriod(period uint16) {
+	if period == 0 {
+		period = 1
+	}
+	t.period = period
 }
 
 func (t *Channel) SetVolume(volume uint8) {
@@ -188,11 +271,33 @@ func (t *Channel) SetVolume(volume uint8) {
 }
 
 // Sound chip
-func (a *AY_3_8912) SetNoiseFreq(freq uint8) {
-	if freq == 0 {
-		freq = 1
+
+// Init sets the chip clock in Hz (CPU clock / 2 on Spectrum).
+func (a *AY_3_8912) Init(clock float64) {
+	a.stepTime = AY_STEP_CLOCKS / clock
+	a.Reset()
+}
+
+func (a *AY_3_8912) Reset() {
+	a.selectedReg = 0
+	for reg := range a.regs {
+		a.selectedReg = uint8(reg)
+		a.write(0)
 	}
-	a.noiseFreq = 1789772.5 / (16 * float64(freq))
+	a.selectedReg = 0
+
+	a.noise.Reset()
+	a.time, a.steps = 0, 0
+	a.sum, a.output = [3]float64{}, [3]float64{}
+}
+
+// Register select and read at 0xfffd (A15=1, A14=1, A1=0), data write at
+// 0xbffd (A15=1, A14=0, A1=0).
+func (a *AY_3_8912) Attach(bus *IoBus) {
+	bus.Register(0xc002, 0xc000,
+		func(addr uint16) uint8 { return a.Read() },
+		func(addr uint16, value uint8) { a.SelectRegister(value) })
+	bus.Register(0xc002, 0x8000, nil, func(addr uint16, value uint8) { a.Write(value) })
 }
 
 func (a *AY_3_8912) SelectRegister(reg uint8) {
@@ -203,67 +308,111 @@ func (a *AY_3_8912) SelectRegister(reg uint8) {
 	}
 }
 
+// Unused bits of the registers read as 0.
+var registerMasks = [15]uint8{
+	0xff, 0x0f, 0xff, 0x0f, 0xff, 0x0f, 0x1f, 0xff,
+	0x1f, 0x1f, 0x1f, 0xff, 0xff, 0x0f, 0xff,
+}
+
 func (a *AY_3_8912) Write(val uint8) {
-	a.regs[a.selectedReg] = val
+	if a.Elapsed != nil {
+		a.run(a.Elapsed())
+	}
+
+	a.write(val)
+
+	if a.RegisterWrite != nil {
+		a.RegisterWrite(a.selectedReg, a.regs[a.selectedReg])
+	}
+}
+
+// Registers returns current values of the registers.
+func (a *AY_3_8912) Registers() [15]uint8 {
+	return a.regs
+}
+
+func (a *AY_3_8912) write(val uint8) {
+	a.regs[a.selectedReg] = val & registerMasks[a.selectedReg]
 
 	switch a.selectedReg {
 	case 0, 1:
-		a.channelA.SetFreq(helpers.To16(a.regs[0], a.regs[1]&0b1111))
+		a.channelA.SetPeriod(helpers.To16(a.regs[0], a.regs[1]))
 	case 2, 3:
-		a.channelB.SetFreq(helpers.To16(a.regs[2], a.regs[3]&0b1111))
+		a.channelB.SetPeriod(helpers.To16(a.regs[2], a.regs[3]))
 	case 4, 5:
-		a.channelC.SetFreq(helpers.To16(a.regs[4], a.regs[5]&0b1111))
+		a.channelC.SetPeriod(helpers.To16(a.regs[4], a.regs[5]))
 	case 6:
-		a.SetNoiseFreq(a.regs[6] & 0b11111)
+		a.noise.SetPeriod(a.regs[6])
 	case 7:
-		a.channelA.onOff = (a.regs[7] & 0b001) == 0
-		a.channelB.onOff = (a.regs[7] & 0b010) == 0
-		a.channelC.onOff = (a.regs[7] & 0b100) == 0
-		a.channelA.noiseOn = (a.regs[7] & 0b001000) == 0
-		a.channelB.noiseOn = (a.regs[7] & 0b010000) == 0
-		a.channelC.noiseOn = (a.regs[7] & 0b100000) == 0
+		a.channelA.toneOff = (a.regs[7] & 0b001) != 0
+		a.channelB.toneOff = (a.regs[7] & 0b010) != 0
+		a.channelC.toneOff = (a.regs[7] & 0b100) != 0
+		a.channelA.noiseOff = (a.regs[7] & 0b001000) != 0
+		a.channelB.noiseOff = (a.regs[7] & 0b010000) != 0
+		a.channelC.noiseOff = (a.regs[7] & 0b100000) != 0
 	case 8:
-		a.channelA.SetVolume(a.regs[8] & 0b1111)
+		a.channelA.SetVolume(a.regs[8])
 	case 9:
-		a.channelB.SetVolume(a.regs[9] & 0b1111)
+		a.channelB.SetVolume(a.regs[9])
 	case 10:
-		a.channelC.SetVolume(a.regs[10] & 0b1111)
+		a.channelC.SetVolume(a.regs[10])
 	case 11, 12:
-		a.env.SetFreq(helpers.To16(a.regs[11], a.regs[12]))
+		a.env.SetPeriod(helpers.To16(a.regs[11], a.regs[12]))
 	case 13:
-		a.env.SetShape(a.regs[13] & 0b1111)
+		a.env.SetShape(a.regs[13])
 	}
 }
 
-func (a *AY_3_8912) Noise(time float64) float64 {
-	// TODO: Pseudo-random noise.
-	freqTime := a.noiseFreq * 2. * math.Pi * time
-
-	v := 1000.
-	for i := 1.; i < 20; i++ {
-		v *= helpers.Approxsin(i * freqTime / (i + 1))
-	}
-
-	return v
-}
-
 func (a *AY_3_8912) Read() uint8 {
 	return a.regs[a.selectedReg]
 }
 
-func (a *AY_3_8912) Sample(timeDelta float64) float64 {
-	a.time += timeDelta
+// Steps the generators and the mixer by 8 AY clocks.
+func (a *AY_3_8912) step() {
+	a.channelA.Step()
+	a.channelB.Step()
+	a.channelC.Step()
+	a.noise.Step()
+	a.env.Step()
 
 	coef := 0.33
-	env := a.env.Update(timeDelta)
-	noise := a.Noise(a.time)
+	noise, env := a.noise.Output(), a.env.AyLevel()
 
-	value := coef * a.channelA.Volume(env) * (a.channelA.Tone(a.time) + a.channelA.Noise(noise))
-	value += coef * a.channelB.Volume(env) * (a.channelB.Tone(a.time) + a.channelB.Noise(noise))
-	value += coef * a.channelC.Volume(env) * (a.channelC.Tone(a.time) + a.channelC.Noise(noise))
+	a.output[0] = coef * a.channelA.Output(noise, env)
+	a.output[1] = coef * a.channelB.Output(noise, env)
+	a.output[2] = coef * a.channelC.Output(noise, env)
+	for i, output := range a.output {
+		a.sum[i] += output
+	}
+	a.steps++
+}
+
+// Runs the chip up to time since the last sample.
+func (a *AY_3_8912) run(time float64) {
+	for a.time < time {
+		a.step()
+		a.time += a.stepTime
+	}
+}
 
-	value = a.dc.Filter(a.dcIndex, value)
+// Sample returns the average output of channels A, B and C over the sample
+// duration timeDelta.
+func (a *AY_3_8912) Sample(timeDelta float64) (channels [3]float64) {
+	a.run(timeDelta)
+	a.time -= timeDelta
+
+	channels = a.output
+	if a.steps > 0 {
+		for i, sum := range a.sum {
+			channels[i] = sum / float64(a.steps)
+		}
+	}
+	a.sum, a.steps = [3]float64{}, 0
+
+	for i := range channels {
+		channels[i] = a.dc[i].Filter(a.dcIndex, channels[i])
+	}
 	a.dcIndex = (a.dcIndex + 1) & (DC_FILTER_SIZE - 1)
 
-	return value
+	return channels
 }
@@ -1,47 +1,77 @@
 package device
 
+// Beeper output is integrated over each audio sample (box filter), every
+// edge counts from the time it happened, so 1-bit music toggling the
+// speaker many times per sample keeps its pulse widths instead of aliasing.
+
+const (
+	beeperHigh = 0.5
+	beeperLow  = -0.5
+)
+
 type Beeper struct {
-	value  bool
-	filter filter
-}
+	value bool
+
+	// Time since the last sample, edges take effect at this time. Without
+	// it they take effect at the start of the next sample.
+	Elapsed func() float64
+
+	level  float64 // Current level.
+	before float64 // Level before the last edge.
+	time   float64 // Time of the last edge since the last sample.
+	sum    float64 // Integral of the level from the last sample to time.
 
-type filter struct {
-	reqValue bool
-	value    float64
-	inc      float64
+	dc      Dc
+	dcIndex int
 }
 
-func (b *Beeper) Init(filt float64) {
-	b.filter.inc = filt
+func (b *Beeper) Init() {
+	b.Reset()
 }
 
 func (b *Beeper) Beep(val bool) {
+	if val == b.value {
+		return
+	}
 	b.value = val
+
+	if b.Elapsed != nil {
+		if t := b.Elapsed(); t > b.time {
+			b.sum += b.level * (t - b.time)
+			b.time = t
+		}
+	}
+
+	b.before = b.level
+	b.level = beeperLow
+	if val {
+		b.level = beeperHigh
+	}
 }
 
 func (b *Beeper) Reset() {
 	b.value = false
+	b.level, b.before = beeperLow, beeperLow
+	b.time, b.sum = 0, 0
 }
 
-func (b *Beeper) Sample() float64 {
-	b.filter.Update(b.value)
-	return b.filter.value
-}
-
-func (f *filter) Update(value bool) {
-	f.reqValue = value
+// Sample returns the average level over the sample duration timeDelta.
+func (b *Beeper) Sample(timeDelta float64) float64 {
+	var value float64
 
-	if f.reqValue {
-		if f.value < 0.5-f.inc {
-			f.value += f.inc
-		} else {
-			f.value = 0.5
-		}
+	if b.time <= timeDelta {
+		value = (b.sum + b.level*(timeDelta-b.time)) / timeDelta
+		b.sum, b.time = 0, 0
 	} else {
-		if f.value > -0.5+f.inc {
-			f.value -= f.inc
-		} else {
-			f.value = -0.5
-		}
+		// The last edge happened after the end of the sample (during the
+		// instruction crossing it), the rest belongs to the next sample.
+		rest := b.before * (b.time - timeDelta)
+		value = (b.sum - rest) / timeDelta
+		b.sum, b.time = rest, b.time-timeDelta
 	}
+
+	value = b.dc.Filter(b.dcIndex, value)
+	b.dcIndex = (b.dcIndex + 1) & (DC_FILTER_SIZE - 1)
+
+	return value
 }
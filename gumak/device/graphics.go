@@ -1,6 +1,6 @@
 package device
 
-import "sync"
+import "encoding/binary"
 
 type Resolution struct {
 	W, H int
@@ -14,113 +14,167 @@ var (
 	DisplayRes = Resolution{256, 192}
 	ScreenRes  = Resolution{320, 240}
 	AttribRes  = Resolution{32, 24}
-	Colors     = [16]RGB{
-		{0, 0, 0},
-		{0, 0, 224},
-		{224, 0, 0},
-		{224, 0, 224},
-		{0, 224, 0},
-		{0, 224, 224},
-		{224, 224, 0},
-		{224, 224, 224},
-
-		{0, 0, 0},
-		{0, 0, 255},
-		{255, 0, 0},
-		{255, 0, 255},
-		{0, 255, 0},
-		{0, 255, 255},
-		{255, 255, 0},
-		{255, 255, 255},
-	}
 )
 
-type position struct {
-	x, y int
+// Output pixel formats.
+type PixelFormat int
+
+const (
+	PIXEL_FORMAT_INDEXED PixelFormat = iota // 1 byte per pixel, colour index (see Screen).
+	PIXEL_FORMAT_RGBA                       // 4 bytes per pixel: R, G, B, A.
+	PIXEL_FORMAT_BGRA                       // 4 bytes per pixel: B, G, R, A.
+)
+
+func (f PixelFormat) BytesPerPixel() int {
+	if f == PIXEL_FORMAT_INDEXED {
+		return 1
+	}
+	return 4
 }
 
-func renderPixel(x, y, r, g, b, a int, data []byte, pw int, evenFlash bool, vram []byte) {
-	pixel, attr := pixelAttr(vram, x, y)
+// Lookup tables of the renderer.
+var (
+	// Offsets of the bitmap and attribute row of each display line.
+	lineOffsets [192]uint16
+	attrOffsets [192]uint16
+
+	// Ink and paper of each attribute for both flash phases and for ULAplus
+	// palette mode.
+	attrColors     [2][256][2]uint8
+	attrColorsPlus [256][2]uint8
+)
 
-	blink := (attr & 0b10000000) != 0
-	if evenFlash && blink {
-		pixel = !pixel
+func init() {
+	for y := range lineOffsets {
+		// BITMAP:
+		// 010 | Y7 Y6 Y2 Y1 Y0 Y5 Y4 Y3 | X4 X3 X2 X1 X0
+		y345 := (y & 0b00111000) << 2
+		y012 := (y & 0b00000111) << 8
+		y67 := (y & 0b11000000) << 5
+		lineOffsets[y] = uint16(y67 | y012 | y345)
+
+		attrOffsets[y] = uint16(6144 + AttribRes.W*(y>>3))
 	}
 
-	color := (attr & 0b00111000) >> 3
-	if pixel {
-		color = attr & 0b00000111
+	for attr := range attrColors[0] {
+		// Attribute: FBPPPIII, F: flash, B: bright, P: paper, I: ink
+		ink := uint8(attr & 0b111)
+		paper := uint8(attr>>3) & 0b111
+		if attr&0b01000000 != 0 {
+			ink += 8
+			paper += 8
+		}
+
+		attrColors[0][attr] = [2]uint8{ink, paper}
+		if attr&0b10000000 != 0 {
+			ink, paper = paper, ink
+		}
+		attrColors[1][attr] = [2]uint8{ink, paper}
+
+		clut := uint8(attr>>6) * 16
+		attrColorsPlus[attr] = [2]uint8{
+			SCREEN_ULAPLUS + clut + uint8(attr&0b111),
+			SCREEN_ULAPLUS + clut + 8 + uint8(attr>>3)&0b111,
+		}
 	}
+}
 
-	contr := (attr & 0b01000000) != 0
-	if contr {
-		color += 8
+// Colours of the palette and ULAplus palette as little endian uint32 in the
+// output format.
+func colorWords(format PixelFormat, palette *Palette, ulaPlus *[64]uint8) (words [SCREEN_ULAPLUS + 64]uint32) {
+	for i, c := range palette {
+		words[i] = colorWord(format, c)
+	}
+	for i, entry := range ulaPlus {
+		words[SCREEN_ULAPLUS+i] = colorWord(format, UlaPlusColor(entry))
 	}
 
-	pos := (y*int(DisplayRes.W) + x) * pw
-	rgb := Colors[color]
-	data[pos+r] = rgb.R
-	data[pos+g] = rgb.G
-	data[pos+b] = rgb.B
-	data[pos+a] = 255
+	return
 }
 
-func pixelAttr(vram []byte, x, y int) (pixel bool, attr uint8) {
-	// TODO:
-
-	bit := 7 - (x & 0x7)
-	xx := x >> 3
-	yy := y >> 3
-	w := (DisplayRes.W >> 3)
+func colorWord(format PixelFormat, c RGB) uint32 {
+	switch format {
+	case PIXEL_FORMAT_RGBA:
+		return uint32(c.R) | uint32(c.G)<<8 | uint32(c.B)<<16 | 0xff<<24
+	case PIXEL_FORMAT_BGRA:
+		return uint32(c.B) | uint32(c.G)<<8 | uint32(c.R)<<16 | 0xff<<24
+	}
+	return 0
+}
 
-	// BITMAP:
-	// 010 | Y7 Y6 Y2 Y1 Y0 Y5 Y4 Y3 | X4 X3 X2 X1 X0
-	y345 := (y & 0b00111000) << 2
-	y012 := (y & 0b00000111) << 8
-	y67 := (y & 0b11000000) << 5
+// Offset of the bitmap byte of a character column on given pixel line.
+func pixelOffset(col, y int) int {
+	return int(lineOffsets[y]) + col
+}
 
-	idx := xx | y67 | y012 | y345
+// Offset of the attribute byte of a character column on given pixel line.
+func attrOffset(col, y int) int {
+	return int(attrOffsets[y]) + col
+}
 
-	pixel = (vram[idx]>>bit)&0x1 != 0
-	attr = vram[6144+w*yy+xx]
-	return
+// Ink and paper of the attribute.
+func cellColors(attr uint8, flash, ulaPlus bool) *[2]uint8 {
+	switch {
+	case ulaPlus:
+		return &attrColorsPlus[attr]
+	case flash:
+		return &attrColors[1][attr]
+	}
+	return &attrColors[0][attr]
 }
 
-func FillDisplayParallel(data []byte, pitch int, evenFlash bool, vram []byte) {
-	// TODO:
-	pw := pitch / int(DisplayRes.W)
+// Renders 8 pixel cell as colour indexes.
+func renderCell(out []uint8, bitmap uint8, colors *[2]uint8) {
+	_ = out[7]
+	for bit := 0; bit < 8; bit++ {
+		out[bit] = colors[(bitmap>>(7-bit))&1^1]
+	}
+}
 
-	var renderQueue = make(chan position)
-	var wg sync.WaitGroup
+// RenderDisplay renders the display area (without the border) of the VRAM
+// in one go, e.g. for screenshots of a headless machine.
+func RenderDisplay(data []byte, pitch int, format PixelFormat, palette *Palette, vram []byte, flash bool) {
+	var cell [8]uint8
+	bpp := format.BytesPerPixel()
+	words := colorWords(format, palette, &[64]uint8{})
 
-	for i := 0; i < 8; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for p := range renderQueue {
-				// TODO: RGB
-				renderPixel(p.x, p.y, 2, 1, 0, 3, data, pw, evenFlash, vram)
+	for y := 0; y < DisplayRes.H; y++ {
+		bitmaps := vram[lineOffsets[y]:]
+		attrs := vram[attrOffsets[y]:]
+		row := data[y*pitch:]
+
+		for col := 0; col < AttribRes.W; col++ {
+			out := row[col*8*bpp:]
+			if format == PIXEL_FORMAT_INDEXED {
+				renderCell(out, bitmaps[col], cellColors(attrs[col], flash, false))
+				continue
 			}
-		}()
-	}
 
-	for y := 0; y < DisplayRes.H; y++ {
-		for x := 0; x < DisplayRes.W; x++ {
-			renderQueue <- position{x, y}
+			renderCell(cell[:], bitmaps[col], cellColors(attrs[col], flash, false))
+			convertRow(out, cell[:], &words, format)
 		}
 	}
+}
+
+// ConvertFrame converts frame of colour indexes generated by the ULA into
+// the output format.
+func ConvertFrame(data []byte, pitch int, format PixelFormat, frame *Screen) {
+	words := colorWords(format, &frame.Palette, &frame.UlaPlus)
 
-	close(renderQueue)
-	wg.Wait()
+	res := frame.Res
+	for y := 0; y < res.H; y++ {
+		convertRow(data[y*pitch:], frame.Pixels[y*res.W:(y+1)*res.W], &words, format)
+	}
 }
 
-func FillDisplay(data []byte, pitch int, evenFlash bool, vram []byte, r, g, b, a int) {
-	// TODO:
-	pw := pitch / int(DisplayRes.W)
+func convertRow(out []byte, pixels []uint8, words *[SCREEN_ULAPLUS + 64]uint32, format PixelFormat) {
+	if format == PIXEL_FORMAT_INDEXED {
+		copy(out, pixels)
+		return
+	}
 
-	for y := 0; y < DisplayRes.H; y++ {
-		for x := 0; x < DisplayRes.W; x++ {
-			renderPixel(x, y, r, g, b, a, data, pw, evenFlash, vram)
-		}
+	out = out[:4*len(pixels)]
+	for i, p := range pixels {
+		binary.LittleEndian.PutUint32(out[4*i:], words[p&0x7f])
 	}
 }
@@ -0,0 +1,65 @@
+package device
+
+// I/O bus, devices register their ports by address mask and value. A device
+// answers when (addr & mask) == value, so the partial decoding of the real
+// hardware is emulated (e.g. ULA answers on any even port).
+//
+// When several devices answer a read they all drive the data bus at once,
+// the result is AND of their values. Port nobody answers reads the floating
+// bus.
+
+type PortRead func(addr uint16) uint8
+type PortWrite func(addr uint16, value uint8)
+
+// IoDevice is a peripheral attaching its ports to the I/O bus.
+type IoDevice interface {
+	Attach(bus *IoBus)
+}
+
+type port struct {
+	mask  uint16
+	value uint16
+	read  PortRead
+	write PortWrite
+}
+
+type IoBus struct {
+	ports []port
+
+	// Value of unattached port, 0xff when not set.
+	Floating PortRead
+}
+
+// Register attaches handlers to all ports matching the mask/value, read or
+// write handler can be nil.
+func (b *IoBus) Register(mask, value uint16, read PortRead, write PortWrite) {
+	b.ports = append(b.ports, port{mask: mask, value: value & mask, read: read, write: write})
+}
+
+func (b *IoBus) Read(addr uint16) uint8 {
+	data := uint8(0xff)
+	answered := false
+
+	for i := range b.ports {
+		p := &b.ports[i]
+		if p.read != nil && addr&p.mask == p.value {
+			data &= p.read(addr)
+			answered = true
+		}
+	}
+
+	if !answered && b.Floating != nil {
+		return b.Floating(addr)
+	}
+
+	return data
+}
+
+func (b *IoBus) Write(addr uint16, value uint8) {
+	for i := range b.ports {
+		p := &b.ports[i]
+		if p.write != nil && addr&p.mask == p.value {
+			p.write(addr, value)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package device
+
+// Kempston joystick interface, port 0x1f decoded by A5-A7 low.
+//
+//   +---+---+---+------+----+------+------+-------+
+//   | 7 | 6 | 5 |  4   | 3  |  2   |  1   |   0   |
+//   +---+---+---+------+----+------+------+-------+
+//   | 0 | 0 | 0 | fire | up | down | left | right |
+//   +---+---+---+------+----+------+------+-------+
+
+const (
+	KEMPSTON_RIGHT = 1 << iota
+	KEMPSTON_LEFT
+	KEMPSTON_DOWN
+	KEMPSTON_UP
+	KEMPSTON_FIRE
+)
+
+type Kempston struct {
+	State    uint8
+	Attached bool // Registered at the I/O bus, see Attach.
+}
+
+func (k *Kempston) Attach(bus *IoBus) {
+	bus.Register(0x00e0, 0x0000, k.Read, nil)
+	k.Attached = true
+}
+
+func (k *Kempston) Press(button uint8, down bool) {
+	if down {
+		k.State |= button
+	} else {
+		k.State &= ^button
+	}
+}
+
+func (k *Kempston) Read(addr uint16) uint8 {
+	return k.State
+}
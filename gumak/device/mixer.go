@@ -0,0 +1,154 @@
+package device
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mixer of the sound sources into stereo output. Each source has its own
+// volume, pan and mute, the sum is scaled by the master gain and clipped.
+
+const (
+	MIXER_BEEPER = iota
+	MIXER_AY_A
+	MIXER_AY_B
+	MIXER_AY_C
+	MIXER_TAPE
+	MIXER_SOURCES
+)
+
+// Placement of the AY channels in the stereo image.
+const (
+	PANNING_MONO = iota
+	PANNING_ABC
+	PANNING_ACB
+	PANNING_BAC
+	PANNING_CUSTOM
+)
+
+const (
+	PAN_LEFT   = 0.0
+	PAN_CENTRE = 0.5
+	PAN_RIGHT  = 1.0
+)
+
+// Headroom of the sum of the sources, full beeper and AY at default volumes
+// do not clip.
+const mixerHeadroom = 0.5
+
+var panningNames = []string{"mono", "abc", "acb", "bac"}
+
+var panningPositions = [][3]float64{
+	{PAN_CENTRE, PAN_CENTRE, PAN_CENTRE},
+	{PAN_LEFT, PAN_CENTRE, PAN_RIGHT},
+	{PAN_LEFT, PAN_RIGHT, PAN_CENTRE},
+	{PAN_CENTRE, PAN_LEFT, PAN_RIGHT},
+}
+
+type Mixer struct {
+	Volume [MIXER_SOURCES]float64 // 0 - 1.
+	Pan    [MIXER_SOURCES]float64 // PAN_LEFT - PAN_RIGHT.
+	Mute   [MIXER_SOURCES]bool
+	Gain   float64 // Master gain.
+
+	panning int
+}
+
+func (m *Mixer) Init() {
+	for i := range m.Volume {
+		m.Volume[i] = 1
+		m.Pan[i] = PAN_CENTRE
+		m.Mute[i] = false
+	}
+
+	m.Gain = 1
+	m.SetPanning(PANNING_MONO)
+}
+
+// SetPanning places the AY channels by preset (PANNING_MONO, ...).
+func (m *Mixer) SetPanning(panning int) {
+	if panning < 0 || panning >= len(panningPositions) {
+		return
+	}
+
+	m.SetPan(panningPositions[panning])
+	m.panning = panning
+}
+
+// SetPan places the AY channels A, B and C.
+func (m *Mixer) SetPan(pan [3]float64) {
+	copy(m.Pan[MIXER_AY_A:MIXER_AY_C+1], pan[:])
+	m.panning = PANNING_CUSTOM
+}
+
+func (m *Mixer) Panning() int {
+	return m.panning
+}
+
+// ParsePanning sets panning by preset name (mono, abc, acb, bac) or by
+// custom pan of the AY channels as 'a,b,c' from 0 (left) to 1 (right).
+func (m *Mixer) ParsePanning(text string) error {
+	for i, name := range panningNames {
+		if strings.EqualFold(text, name) {
+			m.SetPanning(i)
+			return nil
+		}
+	}
+
+	parts := strings.Split(text, ",")
+	if len(parts) != 3 {
+		return fmt.Errorf("Unknown panning '%s', expected %s or a,b,c", text, strings.Join(panningNames, ", "))
+	}
+
+	var pan [3]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || value < PAN_LEFT || value > PAN_RIGHT {
+			return fmt.Errorf("Invalid pan '%s', expected 0 to 1", part)
+		}
+		pan[i] = value
+	}
+
+	m.SetPan(pan)
+	return nil
+}
+
+// Mix returns left and right output of the sources, clipped to -1..1.
+// Centered source is at full volume on both sides.
+func (m *Mixer) Mix(sources [MIXER_SOURCES]float64) (left, right float64) {
+	for i, value := range sources {
+		if m.Mute[i] {
+			continue
+		}
+
+		value *= m.Volume[i]
+		left += value * min(1, 2*(PAN_RIGHT-m.Pan[i]))
+		right += value * min(1, 2*m.Pan[i])
+	}
+
+	gain := mixerHeadroom * m.Gain
+	return clip(gain * left), clip(gain * right)
+}
+
+// SampleInt16 converts -1..1 sample to signed 16-bit.
+func SampleInt16(sample float32) int16 {
+	return int16(32767 * sample)
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func clip(value float64) float64 {
+	switch {
+	case value > 1:
+		return 1
+	case value < -1:
+		return -1
+	}
+	return value
+}
@@ -0,0 +1,167 @@
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Palette of 8 normal and 8 bright colours in the order of the attribute
+// bits (black, blue, red, magenta, green, cyan, yellow, white).
+type Palette [16]RGB
+
+type NamedPalette struct {
+	Name    string
+	Palette Palette
+}
+
+// Builds palette from the intensities of the normal and bright colours.
+func intensityPalette(normal, bright uint8) (p Palette) {
+	for i := range p {
+		v := normal
+		if i >= 8 {
+			v = bright
+		}
+
+		if i&0b001 != 0 {
+			p[i].B = v
+		}
+		if i&0b010 != 0 {
+			p[i].R = v
+		}
+		if i&0b100 != 0 {
+			p[i].G = v
+		}
+	}
+
+	return
+}
+
+// Monochrome palette with the luminance of the default colours.
+func monochromePalette(tint RGB) (p Palette) {
+	for i, c := range PaletteDefault {
+		y := (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+		p[i] = RGB{uint8(y * int(tint.R) / 255), uint8(y * int(tint.G) / 255), uint8(y * int(tint.B) / 255)}
+	}
+
+	return
+}
+
+var (
+	PaletteDefault = intensityPalette(224, 255)
+	// Normal colours darker than the default ones.
+	PaletteDim = intensityPalette(215, 255)
+	// Bigger difference between normal and bright colours.
+	PaletteHighContrast = intensityPalette(160, 255)
+	PaletteGrey         = monochromePalette(RGB{255, 255, 255})
+	PaletteGreen        = monochromePalette(RGB{51, 255, 102})
+	// Okabe-Ito colours distinguishable with colour vision deficiency,
+	// normal colours are darker.
+	PaletteColorBlind = Palette{
+		{0, 0, 0}, {0, 97, 151}, {181, 80, 0}, {173, 103, 142},
+		{0, 134, 98}, {73, 153, 198}, {204, 194, 56}, {216, 216, 216},
+		{0, 0, 0}, {0, 114, 178}, {213, 94, 0}, {204, 121, 167},
+		{0, 158, 115}, {86, 180, 233}, {240, 228, 66}, {255, 255, 255},
+	}
+)
+
+var Palettes = []NamedPalette{
+	{"default", PaletteDefault},
+	{"dim", PaletteDim},
+	{"contrast", PaletteHighContrast},
+	{"grey", PaletteGrey},
+	{"green", PaletteGreen},
+	{"colorblind", PaletteColorBlind},
+}
+
+func FindPalette(name string) (Palette, bool) {
+	for _, p := range Palettes {
+		if p.Name == name {
+			return p.Palette, true
+		}
+	}
+
+	return Palette{}, false
+}
+
+// ParsePalette reads palette from text, one colour per line either as
+// "#rrggbb" or decimal "r g b". Empty lines and lines starting with ';' are
+// ignored.
+//
+//	; Default palette
+//	#000000
+//	0 0 224
+//	...
+func ParsePalette(reader io.Reader) (Palette, error) {
+	var p Palette
+	count := 0
+
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == ';' {
+			continue
+		}
+
+		if count == len(p) {
+			return p, fmt.Errorf("Line %d: palette has more than %d colours", line, len(p))
+		}
+
+		c, err := parseColor(text)
+		if err != nil {
+			return p, fmt.Errorf("Line %d: %w", line, err)
+		}
+
+		p[count] = c
+		count++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+
+	if count != len(p) {
+		return p, fmt.Errorf("Palette has %d colours, expected %d", count, len(p))
+	}
+
+	return p, nil
+}
+
+func parseColor(text string) (RGB, error) {
+	if text[0] == '#' {
+		v, err := strconv.ParseUint(text[1:], 16, 32)
+		if err != nil || len(text) != 7 {
+			return RGB{}, fmt.Errorf("Invalid colour '%s'", text)
+		}
+		return RGB{uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) != 3 {
+		return RGB{}, fmt.Errorf("Invalid colour '%s'", text)
+	}
+
+	var rgb [3]uint8
+	for i, f := range fields {
+		v, err := strconv.ParseUint(f, 10, 8)
+		if err != nil {
+			return RGB{}, fmt.Errorf("Invalid colour '%s'", text)
+		}
+		rgb[i] = uint8(v)
+	}
+
+	return RGB{rgb[0], rgb[1], rgb[2]}, nil
+}
+
+func LoadPalette(file string) (Palette, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Palette{}, err
+	}
+	defer f.Close()
+
+	return ParsePalette(f)
+}
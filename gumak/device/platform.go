@@ -1,5 +0,0 @@
-package device
-
-type Platform interface {
-	Update()
-}
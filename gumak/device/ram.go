@@ -1,19 +1,47 @@
 package device
 
 import (
-	"embed"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
 	"mutex/gumak/log"
 )
 
+const ROM_SIZE = 0x4000
+
+// Page attributes.
+type PageAttr uint8
+
+const (
+	PAGE_READ_ONLY PageAttr = 1 << iota // ROM mapped.
+	PAGE_CONTENDED                      // Shared with the ULA.
+	PAGE_UNMAPPED                       // No memory chips (upper 32K of 16K model), reads float, writes are lost.
+	PAGE_RAM                            // RAM bank mapped, in page 0 only in +3 special paging.
+)
+
 type Ram struct {
-	roms [2][0x4000]uint8
+	roms [4][0x4000]uint8
 	// 8 banks of 16K.
 	banks [8][0x4000]uint8
 
 	// Mapping of active banks.
 	page [4][]uint8
 
+	// Attributes of the pages, follow the mapping.
+	attr           [4]PageAttr
+	contendedBanks uint8
+
+	// Reads of unmapped pages return floating bus value.
+	FloatingBus func() uint8
+
+	// Writes into ROM are ignored unless enabled, RomWrite is called for
+	// each of them (debugging of errant code).
+	romWritable bool
+	RomWrite    func(addr uint16, value uint8)
+
 	pagingEnabled bool
+	specialPaging bool
 
 	activeRom  int
 	activeBank int
@@ -24,41 +52,130 @@ const (
 	BANK_VRAM_SHADOW = 7
 )
 
+// ROM slot of the TR-DOS (Beta Disk interface) ROM.
+const ROM_TRDOS = 2
+
+const (
+	CONTENDED_BANKS_48K   = 0b00100000 // Only 0x4000-0x7fff
+	CONTENDED_BANKS_128K  = 0b10101010 // Odd banks
+	CONTENDED_BANKS_PLUS3 = 0b11110000 // Banks 4-7
+	CONTENDED_BANKS_NONE  = 0b00000000
+)
+
+// +2A/+3 special (all RAM) paging configurations selected by bits 1-2 of
+// port 0x1ffd.
+var specialPagingBanks = [4][4]int{
+	{0, 1, 2, 3},
+	{4, 5, 6, 7},
+	{4, 5, 6, 3},
+	{4, 7, 6, 3},
+}
+
 func (r *Ram) DumpState() {
 	log.Debug("ROM / PAGE[0] = %d ", r.activeRom)
 	log.Debug("PAGE[3] = BANK_%d ", r.activeBank)
+	log.Debug("Special paging: %t", r.specialPaging)
+}
+
+func (r *Ram) mapBank(page int, bank int) {
+	r.page[page] = r.banks[bank][:]
+	r.attr[page] = r.attr[page]&PAGE_UNMAPPED | PAGE_RAM
+	if r.contendedBanks&(1<<bank) != 0 {
+		r.attr[page] |= PAGE_CONTENDED
+	}
+}
+
+func (r *Ram) mapRom(rom int) {
+	r.page[0] = r.roms[rom][:]
+	r.attr[0] = r.attr[0]&PAGE_UNMAPPED | PAGE_READ_ONLY
 }
 
 func (r *Ram) SetRom(rom int) {
 	if r.pagingEnabled {
 		r.activeRom = rom
-		r.page[0] = r.roms[rom][:]
+		if !r.specialPaging {
+			r.mapRom(rom)
+		}
 	}
 }
 
 func (r *Ram) SetPageBank(page int, bank int) {
 	if r.pagingEnabled {
-		if page != 3 {
-			panic("Swapping other bank than 3!")
+		if page == 3 {
+			r.activeBank = bank
+		}
+		if !r.specialPaging {
+			r.mapBank(page, bank)
+		}
+	}
+}
+
+// SetSpecialPaging switches +2A/+3 all RAM configuration, when disabled the
+// normal ROM + 3 banks mapping is restored.
+func (r *Ram) SetSpecialPaging(enabled bool, config int) {
+	if !r.pagingEnabled {
+		return
+	}
+
+	r.specialPaging = enabled
+
+	if enabled {
+		for page, bank := range specialPagingBanks[config&0b11] {
+			r.mapBank(page, bank)
 		}
-		r.activeBank = bank
-		r.page[page] = r.banks[bank][:]
+	} else {
+		r.mapRom(r.activeRom)
+		r.mapBank(1, 5)
+		r.mapBank(2, 2)
+		r.mapBank(3, r.activeBank)
 	}
 }
 
 func (r *Ram) Init() {
 	r.pagingEnabled = true
+	r.specialPaging = false
 
 	r.SetRom(0)
-	r.page[1] = r.banks[5][:]
-	r.page[2] = r.banks[2][:]
-	r.page[3] = r.banks[0][:]
+	r.SetPageBank(1, 5)
+	r.SetPageBank(2, 2)
+	r.SetPageBank(3, 0)
 }
 
 func (r *Ram) SetPagingEnabled(enabled bool) {
 	r.pagingEnabled = enabled
 }
 
+func (r *Ram) PagingEnabled() bool {
+	return r.pagingEnabled
+}
+
+// SetContendedBanks sets mask of banks which are contended by the ULA.
+func (r *Ram) SetContendedBanks(mask uint8) {
+	r.contendedBanks = mask
+}
+
+func (r *Ram) Contended(addr uint16) bool {
+	return r.attr[addr>>14]&PAGE_CONTENDED != 0
+}
+
+func (r *Ram) SetPagePopulated(page int, populated bool) {
+	if populated {
+		r.attr[page] &^= PAGE_UNMAPPED
+	} else {
+		r.attr[page] |= PAGE_UNMAPPED
+	}
+}
+
+// PageAttributes returns attributes of currently mapped page.
+func (r *Ram) PageAttributes(page int) PageAttr {
+	return r.attr[page]
+}
+
+// SetRomWritable allows writes into the ROM (tests, ROM development).
+func (r *Ram) SetRomWritable(writable bool) {
+	r.romWritable = writable
+}
+
 func (r *Ram) Page(page int) []uint8 {
 	return r.page[page]
 }
@@ -105,20 +222,42 @@ func (r *Ram) Size() uint32 {
 	return uint32(64 * 1024)
 }
 
-func (r *Ram) LoadRom(fs embed.FS, file string, rom int, length uint16) (int, error) {
-	f, err := embed.FS.Open(fs, file)
+// LoadRom loads ROM image from the file system (embedded or host one).
+func (r *Ram) LoadRom(fsys fs.FS, file string, rom int, checksum uint32) error {
+	f, err := fsys.Open(file)
 	if err != nil {
-		return 0, err
+		return err
 	}
+	defer f.Close()
 
-	size, err := f.Read(r.roms[rom][:length])
+	return r.LoadRomReader(f, rom, checksum)
+}
+
+// LoadRomReader loads ROM image into the ROM slot. Image has to be exactly
+// 16K, checksum (CRC-32) is verified when not 0. The slot is not modified
+// when the validation fails.
+func (r *Ram) LoadRomReader(reader io.Reader, rom int, checksum uint32) error {
+	if rom < 0 || rom >= len(r.roms) {
+		return fmt.Errorf("Invalid ROM slot %d", rom)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, ROM_SIZE+1))
 	if err != nil {
-		return 0, err
+		return err
+	}
+
+	if len(data) != ROM_SIZE {
+		return fmt.Errorf("Invalid ROM size: expected %d bytes, got %d", ROM_SIZE, len(data))
+	}
+
+	if sum := crc32.ChecksumIEEE(data); checksum != 0 && sum != checksum {
+		return fmt.Errorf("Invalid ROM checksum: expected %08x, got %08x", checksum, sum)
 	}
 
-	log.Info("Loaded %d bytes into ROM[%d]", size, rom)
+	copy(r.roms[rom][:], data)
+	log.Info("Loaded %d bytes into ROM[%d]", len(data), rom)
 
-	return size, nil
+	return nil
 }
 
 func pageOffset(addr uint16) (page int, offset uint16) {
@@ -127,10 +266,28 @@ func pageOffset(addr uint16) (page int, offset uint16) {
 
 func (r *Ram) Read(addr uint16) uint8 {
 	page, offset := pageOffset(addr)
+	if r.attr[page]&PAGE_UNMAPPED != 0 {
+		if r.FloatingBus != nil {
+			return r.FloatingBus()
+		}
+		return 0xff
+	}
 	return r.page[page][offset]
 }
 
 func (r *Ram) Write(addr uint16, dataBus uint8) {
 	page, offset := pageOffset(addr)
+	attr := r.attr[page]
+	if attr&PAGE_UNMAPPED != 0 {
+		return
+	}
+	if attr&PAGE_READ_ONLY != 0 {
+		if r.RomWrite != nil {
+			r.RomWrite(addr, dataBus)
+		}
+		if !r.romWritable {
+			return
+		}
+	}
 	r.page[page][offset] = dataBus
 }
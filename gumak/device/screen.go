@@ -0,0 +1,259 @@
+package device
+
+import (
+	"fmt"
+	"math"
+)
+
+// The ULA generates the picture progressively, the screen is rendered in
+// 8 pixel cells at the T-state the beam passes them, so changes of the VRAM
+// or the border done while the beam is drawing (multicolour, rainbow effects,
+// loading stripes, border music) show up in the right place. Screen is kept
+// as colour indexes (see Palette), finished frame is double buffered.
+//
+// The display area is centered in the screen, the border around it is drawn
+// 2 pixels per T-state:
+//
+//	+-----------------------------+ <- ScreenStart - top*TStatesPerLine - left/2
+//	|           border            |
+//	|    +-------------------+    |
+//	|    |  display 256x192  |    | <- ScreenStart
+//	|    +-------------------+    |
+//	|                             |
+//	+-----------------------------+
+
+// Colour indexes from SCREEN_ULAPLUS are ULAplus palette entries.
+const SCREEN_ULAPLUS = 16
+
+// Screen generated by the ULA, one colour index per pixel.
+type Screen struct {
+	Pixels []uint8
+	Res    Resolution
+
+	// Palette and ULAplus palette at the end of the frame.
+	Palette Palette
+	UlaPlus [64]uint8
+
+	// Timex hi-res frame has double width, standard cells are doubled.
+	HiRes bool
+}
+
+func NewScreen(res Resolution) *Screen {
+	return &Screen{
+		Pixels: make([]uint8, res.W*res.H),
+		Res:    res,
+	}
+}
+
+// Frame of the standard or Timex hi-res (double width) mode.
+func newFrameScreen(res Resolution, hiRes bool) *Screen {
+	if hiRes {
+		res.W *= 2
+	}
+
+	screen := NewScreen(res)
+	screen.HiRes = hiRes
+	return screen
+}
+
+func (s *Screen) CopyTo(output *Screen) {
+	if len(output.Pixels) != len(s.Pixels) {
+		output.Pixels = make([]uint8, len(s.Pixels))
+	}
+
+	copy(output.Pixels, s.Pixels)
+	output.Res = s.Res
+	output.Palette = s.Palette
+	output.UlaPlus = s.UlaPlus
+	output.HiRes = s.HiRes
+}
+
+// Horizontal pixels per standard pixel.
+func (s *Screen) scale() int {
+	if s.HiRes {
+		return 2
+	}
+	return 1
+}
+
+// Size of the border around the display area in standard pixels.
+func (s *Screen) border() (left, top int) {
+	return (s.Res.W/s.scale() - DisplayRes.W) / 2, (s.Res.H - DisplayRes.H) / 2
+}
+
+// DisplayArea returns position and size of the display area (without the
+// border) in the screen pixels.
+func (s *Screen) DisplayArea() (x, y, width, height int) {
+	left, top := s.border()
+	return left * s.scale(), top, DisplayRes.W * s.scale(), DisplayRes.H
+}
+
+// SetScreenRes sets resolution of the generated screen (display area and the
+// border), the border has to fit into the line and the frame. Border lines
+// outside of the scan lines around the display (e.g. bottom 52 lines on
+// Pentagon) are padded with the border colour.
+func (ula *Ula) SetScreenRes(res Resolution) error {
+	left := (res.W - DisplayRes.W) / 2
+	t := &ula.timing
+
+	switch {
+	case res.W < DisplayRes.W || res.H < DisplayRes.H:
+		return fmt.Errorf("Screen %dx%d is smaller than the display area", res.W, res.H)
+	case left%8 != 0 || (res.H-DisplayRes.H)%2 != 0:
+		return fmt.Errorf("Screen %dx%d: border has to be multiple of 8 pixels", res.W, res.H)
+	case left > t.TStatesPerLine-128:
+		return fmt.Errorf("Screen %dx%d: border is wider than the line", res.W, res.H)
+	case res.H > t.ScanLines:
+		return fmt.Errorf("Screen %dx%d: border is higher than the frame", res.W, res.H)
+	}
+
+	hiRes := ula.Timex.ScreenMode() == TIMEX_SCREEN_HIRES
+	ula.screenRes = res
+	ula.screen = newFrameScreen(res, hiRes)
+	ula.Frame = newFrameScreen(res, hiRes)
+	ula.Frame.Palette = ula.Palette
+	ula.nextCell = 0
+
+	return nil
+}
+
+// Update renders all cells the beam has passed up to the T-state of the
+// frame. Has to be called before anything visible (VRAM, VRAM bank, border)
+// changes.
+func (ula *Ula) Update(tState int) {
+	res := ula.screen.Res
+	scale := ula.screen.scale()
+	cols := res.W / 8 / scale
+	cells := cols * res.H
+	left, top := ula.screen.border()
+	ulaPlus := ula.UlaPlus.Enabled()
+	mode := ula.Timex.ScreenMode()
+
+	for ula.nextCell < cells {
+		y, x := ula.nextCell/cols, (ula.nextCell%cols)*8
+		line, pos := y-top, x-left
+
+		// Padding outside of the frame is drawn at its start or end.
+		cellTState := ula.timing.ScreenStart + line*ula.timing.TStatesPerLine + pos/2
+		if cellTState > tState && cellTState < ula.timing.TStatesPerFrame() {
+			return
+		}
+
+		out := ula.screen.Pixels[y*res.W+x*scale : y*res.W+(x+8)*scale]
+		if line >= 0 && line < DisplayRes.H && pos >= 0 && pos < DisplayRes.W {
+			ula.renderDisplayCell(out, line, pos/8, mode, ulaPlus, cellTState)
+		} else {
+			border := ula.BorderColor
+			switch {
+			case mode == TIMEX_SCREEN_HIRES:
+				border = ula.Timex.hiResColors()[1]
+			case ulaPlus:
+				border += SCREEN_ULAPLUS + 8
+			}
+			for i := range out {
+				out[i] = border
+			}
+		}
+
+		ula.nextCell++
+	}
+}
+
+// Renders cell of the display area in the screen mode, out has 8 pixels or
+// 16 pixels for hi-res frame.
+func (ula *Ula) renderDisplayCell(out []uint8, line, col int, mode uint8, ulaPlus bool, tState int) {
+	vram := ula.ram.Bank(ula.VRamBank)
+	flash := ula.Frames >= 16
+
+	if r, ok := ula.snowAt(tState); ok && mode == TIMEX_SCREEN_STANDARD && len(out) == 8 {
+		bitmap := vram[pixelOffset(col, line)&^0xff|int(r)]
+		attr := vram[attrOffset(col, line)&^0xff|int(r)]
+		renderCell(out, bitmap, cellColors(attr, flash, ulaPlus))
+		return
+	}
+
+	var cell [16]uint8
+	pixels := cell[:8]
+
+	switch mode {
+	case TIMEX_SCREEN_SECOND:
+		colors := cellColors(vram[timexScreen1+attrOffset(col, line)], flash, ulaPlus)
+		renderCell(pixels, vram[timexScreen1+pixelOffset(col, line)], colors)
+	case TIMEX_SCREEN_HICOLOR:
+		colors := cellColors(vram[timexScreen1+pixelOffset(col, line)], flash, ulaPlus)
+		renderCell(pixels, vram[pixelOffset(col, line)], colors)
+	case TIMEX_SCREEN_HIRES:
+		colors := ula.Timex.hiResColors()
+		renderCell(cell[:8], vram[pixelOffset(col, line)], &colors)
+		renderCell(cell[8:], vram[timexScreen1+pixelOffset(col, line)], &colors)
+		pixels = cell[:]
+	default:
+		colors := cellColors(vram[attrOffset(col, line)], flash, ulaPlus)
+		renderCell(pixels, vram[pixelOffset(col, line)], colors)
+	}
+
+	// Scale the cell to the frame width.
+	for i := range out {
+		out[i] = pixels[i*len(pixels)/len(out)]
+	}
+}
+
+type snowEvent struct {
+	tState int
+	r      uint8
+}
+
+// Snow records refresh cycle of contended memory at the T-state, the
+// display fetch at the same time uses R as the low byte of the address.
+func (ula *Ula) Snow(tState int, r uint8) {
+	if !ula.timing.Snow {
+		return
+	}
+
+	if _, pos, ok := ula.timing.fetchPosition(tState); ok && pos&0b111 < 4 {
+		ula.snow = append(ula.snow, snowEvent{tState, r})
+	}
+}
+
+// Refresh address of the cell fetched at T-state, ok is false if there is
+// no snow.
+func (ula *Ula) snowAt(tState int) (r uint8, ok bool) {
+	for len(ula.snow) > 0 && ula.snow[0].tState < tState {
+		ula.snow = ula.snow[1:]
+	}
+
+	if len(ula.snow) > 0 && ula.snow[0].tState < tState+4 {
+		return ula.snow[0].r, true
+	}
+
+	return 0, false
+}
+
+// LatchPalette applies the palette and the ULAplus palette to the frame being
+// generated and to the last finished frame without waiting for the end of
+// the frame, e.g. after a snapshot load.
+func (ula *Ula) LatchPalette() {
+	for _, screen := range []*Screen{ula.screen, ula.Frame} {
+		screen.Palette = ula.Palette
+		if ula.UlaPlus != nil {
+			screen.UlaPlus = ula.UlaPlus.Palette
+		}
+	}
+}
+
+// Finishes the frame and starts the next one, its width follows the Timex
+// screen mode.
+func (ula *Ula) endScreen() {
+	ula.Update(math.MaxInt)
+	ula.screen.Palette = ula.Palette
+	if ula.UlaPlus != nil {
+		ula.screen.UlaPlus = ula.UlaPlus.Palette
+	}
+	ula.screen, ula.Frame = ula.Frame, ula.screen
+	ula.nextCell = 0
+	ula.snow = ula.snow[:0]
+
+	if hiRes := ula.Timex.ScreenMode() == TIMEX_SCREEN_HIRES; hiRes != ula.screen.HiRes {
+		ula.screen = newFrameScreen(ula.screenRes, hiRes)
+	}
+}
@@ -0,0 +1,72 @@
+package device
+
+// Timex TC2048/TS2068 SCLD screen control, port 0xff (A0-A7 decoded):
+//
+//   +-----+-----+-------+-----------------------------------------+
+//   |  7  |  6  | 5 - 3 | 2 - 0                                   |
+//   +-----+-----+-------+-----------------------------------------+
+//   |  -  | INT | ink   | 000 standard screen at 0x4000           |
+//   |     | off | (hi-  | 001 second screen at 0x6000             |
+//   |     |     | res)  | 010 hi-colour, 8x1 attributes at 0x6000 |
+//   |     |     |       | 110 hi-res 512x192, columns alternate   |
+//   |     |     |       |     between 0x4000 and 0x6000           |
+//   +-----+-----+-------+-----------------------------------------+
+//
+// Hi-res mode has only two colours, ink from bits 3-5 and its complement as
+// paper (used for the border too).
+
+const (
+	TIMEX_SCREEN_STANDARD = 0b000
+	TIMEX_SCREEN_SECOND   = 0b001
+	TIMEX_SCREEN_HICOLOR  = 0b010
+	TIMEX_SCREEN_HIRES    = 0b110
+)
+
+// Offset of the second screen in the VRAM bank.
+const timexScreen1 = 0x2000
+
+type Timex struct {
+	Port uint8 // Last value written into port 0xff.
+}
+
+func (t *Timex) Attach(bus *IoBus) {
+	bus.Register(0x00ff, 0x00ff, t.Read, t.Write)
+}
+
+func (t *Timex) Reset() {
+	t.Port = 0
+}
+
+func (t *Timex) Write(addr uint16, value uint8) {
+	t.Port = value
+}
+
+func (t *Timex) Read(addr uint16) uint8 {
+	return t.Port
+}
+
+// ScreenMode returns one of TIMEX_SCREEN_*, standard when not attached.
+func (t *Timex) ScreenMode() uint8 {
+	if t == nil {
+		return TIMEX_SCREEN_STANDARD
+	}
+
+	switch mode := t.Port & 0b111; {
+	case mode&0b100 != 0:
+		return TIMEX_SCREEN_HIRES
+	case mode&0b010 != 0:
+		return TIMEX_SCREEN_HICOLOR
+	default:
+		return mode
+	}
+}
+
+func (t *Timex) InterruptDisabled() bool {
+	return t != nil && t.Port&0b1000000 != 0
+}
+
+// Ink and paper of the hi-res mode.
+func (t *Timex) hiResColors() [2]uint8 {
+	ink := (t.Port >> 3) & 0b111
+	return [2]uint8{ink, ink ^ 0b111}
+}
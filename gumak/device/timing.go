@@ -0,0 +1,170 @@
+package device
+
+// ULA timing of a single frame, T-states are counted from the start of the
+// interrupt, so the position of the interrupt is given by the T-state of the
+// first display fetch.
+//
+// Contention: while the ULA fetches the display data the CPU is halted when
+// it accesses contended memory (or I/O). Each screen line starts with 128
+// T-states of display fetches, the delay repeats with 8 T-state period.
+//
+//   48K/128K: 6, 5, 4, 3, 2, 1, 0, 0
+//   +2A/+3:   1, 0, 7, 6, 5, 4, 3, 2
+//   Pentagon: no contention
+//
+// Snow: 48K/128K ULA takes the low byte of the display fetch address from
+// the address bus when the CPU refreshes contended memory (I register
+// 0x40-0x7f) at the same time, the fetched byte is replaced by a byte of
+// the same 256 byte block.
+
+type Timing struct {
+	TStatesPerLine    int
+	ScanLines         int
+	ScreenStart       int    // T-state of the first display fetch.
+	InterruptLength   int    // T-states the INT is held active.
+	ContentionPattern [8]int // Delay for each T-state of the 8 T-state fetch cycle.
+	ContendedIo       bool   // +2A/+3 does not contend I/O.
+	Snow              bool   // Refresh of contended memory corrupts the display fetch.
+}
+
+var (
+	Timing48K = Timing{
+		TStatesPerLine:    224,
+		ScanLines:         312,
+		ScreenStart:       14336,
+		InterruptLength:   32,
+		ContentionPattern: [8]int{6, 5, 4, 3, 2, 1, 0, 0},
+		ContendedIo:       true,
+		Snow:              true,
+	}
+	Timing48KNtsc = Timing{
+		TStatesPerLine:    224,
+		ScanLines:         264,
+		ScreenStart:       8960,
+		InterruptLength:   32,
+		ContentionPattern: [8]int{6, 5, 4, 3, 2, 1, 0, 0},
+		ContendedIo:       true,
+		Snow:              true,
+	}
+	Timing128K = Timing{
+		TStatesPerLine:    228,
+		ScanLines:         311,
+		ScreenStart:       14362,
+		InterruptLength:   36,
+		ContentionPattern: [8]int{6, 5, 4, 3, 2, 1, 0, 0},
+		ContendedIo:       true,
+		Snow:              true,
+	}
+	TimingPlus3 = Timing{
+		TStatesPerLine:    228,
+		ScanLines:         311,
+		ScreenStart:       14362,
+		InterruptLength:   32,
+		ContentionPattern: [8]int{1, 0, 7, 6, 5, 4, 3, 2},
+		ContendedIo:       false,
+	}
+	TimingPentagon = Timing{
+		TStatesPerLine:    224,
+		ScanLines:         320,
+		ScreenStart:       17988,
+		InterruptLength:   32,
+		ContentionPattern: [8]int{0, 0, 0, 0, 0, 0, 0, 0},
+		ContendedIo:       false,
+	}
+)
+
+func (t *Timing) TStatesPerFrame() int {
+	return t.TStatesPerLine * t.ScanLines
+}
+
+// Position of the display fetch for given T-state, ok is false outside of
+// the display area.
+func (t *Timing) fetchPosition(tState int) (line, pos int, ok bool) {
+	// Contention starts one T-state before the first fetch.
+	rel := tState - t.ScreenStart + 1
+	if rel < 0 || t.TStatesPerLine == 0 {
+		return 0, 0, false
+	}
+
+	line, pos = rel/t.TStatesPerLine, rel%t.TStatesPerLine
+	if line >= DisplayRes.H || pos >= 128 {
+		return 0, 0, false
+	}
+
+	return line, pos, true
+}
+
+// Contention returns number of T-states the CPU is delayed when accessing
+// contended memory at given T-state of a frame.
+func (t *Timing) Contention(tState int) int {
+	_, pos, ok := t.fetchPosition(tState)
+	if !ok {
+		return 0
+	}
+
+	return t.ContentionPattern[pos&0b111]
+}
+
+// IoContention returns delay of I/O access to the port.
+//
+//	High byte    | Bit 0 | Contention pattern
+//	-------------+-------+-------------------
+//	No           | Reset | N:1, C:3
+//	No           | Set   | N:4
+//	Yes          | Reset | C:1, C:3
+//	Yes          | Set   | C:1, C:1, C:1, C:1
+func (t *Timing) IoContention(addr uint16, tState int, contendedHigh bool) int {
+	if !t.ContendedIo {
+		return 0
+	}
+
+	ulaPort := addr&0x1 == 0
+	delay := 0
+
+	step := func(contended bool, length int) {
+		if contended {
+			delay += t.Contention(tState + delay)
+		}
+		tState += length
+	}
+
+	switch {
+	case contendedHigh && ulaPort:
+		step(true, 1)
+		step(true, 3)
+	case contendedHigh:
+		step(true, 1)
+		step(true, 1)
+		step(true, 1)
+		step(true, 1)
+	case ulaPort:
+		step(false, 1)
+		step(true, 3)
+	}
+
+	return delay
+}
+
+// FloatingBus returns value the ULA is reading from the VRAM at given
+// T-state, 0xff when it does not read anything.
+func (t *Timing) FloatingBus(tState int, vram []byte) uint8 {
+	line, pos, ok := t.fetchPosition(tState - 1)
+	if !ok {
+		return 0xff
+	}
+
+	col := (pos >> 3) << 1
+
+	switch pos & 0b111 {
+	case 0:
+		return vram[pixelOffset(col, line)]
+	case 1:
+		return vram[attrOffset(col, line)]
+	case 2:
+		return vram[pixelOffset(col+1, line)]
+	case 3:
+		return vram[attrOffset(col+1, line)]
+	}
+
+	return 0xff
+}
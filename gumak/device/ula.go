@@ -2,7 +2,7 @@ package device
 
 import "mutex/gumak/helpers"
 
-// FE port:
+// FE port (any even port):
 //
 //    +---+------+---+-------+------+---+---+---+
 //    | 7 |  6   | 5 |   4   |  3   | 2 | 1 | 0 |
@@ -18,115 +18,252 @@ import "mutex/gumak/helpers"
 // 0xfdfe  A, S, D, F, G                0xdffe  P, O, I, U, Y
 // 0xfbfe  Q, W, E, R, T                0xbffe  ENTER, L, K, J, H
 // 0xf7fe  1, 2, 3, 4, 5                0x7ffe  SPACE, SYM SHFT, M, N, B
+//
+// Each zero bit of the high byte selects a row, rows are AND-ed together.
+
+// 7FFD port (128K decodes A15=0, A1=0, +2A/+3 A15=0, A14=1, A1=0):
+//
+//   Bit 0-2: bank at 0xc000
+//   Bit 3:   0=VRAM, 1=Shadow VRAM
+//   Bit 4:   ROM select (low bit on +2A/+3)
+//   Bit 5:   disable paging until reset
+//
+// 1FFD port (+2A/+3, decodes A15-A12=0001, A1=0):
+//
+//   Bit 0:   special paging (all RAM)
+//   Bit 1-2: special paging configuration, bit 2 is high bit of ROM select
+//            in normal paging
+//   Bit 3:   disk motor
+//   Bit 4:   printer strobe
+
+// Floating bus, value the CPU reads from unpopulated memory and unattached
+// ports.
+const (
+	FLOATING_BUS_ULA   = iota // Byte the ULA is fetching (48K, 128K).
+	FLOATING_BUS_PLUS3        // Only on ports 0000xxxxxxxxxx01 while paging is unlocked.
+	FLOATING_BUS_NONE         // Always 0xff.
+)
+
+// Decoding of a port, the port answers when (addr & Mask) == Value. Zero
+// Mask means the port is not present.
+type PortDecoding struct {
+	Mask  uint16
+	Value uint16
+}
+
+// Paging describes memory paging ports of the machine and its floating bus.
+type Paging struct {
+	Port7ffd    PortDecoding // Bank, screen and ROM select, lock.
+	Port1ffd    PortDecoding // Special paging and ROM high bit.
+	FloatingBus int          // FLOATING_BUS_*.
+}
+
+var (
+	PagingNone     = Paging{FloatingBus: FLOATING_BUS_ULA}
+	Paging128      = Paging{Port7ffd: PortDecoding{0x8002, 0x0000}, FloatingBus: FLOATING_BUS_ULA}
+	PagingPlus3    = Paging{Port7ffd: PortDecoding{0xc002, 0x4000}, Port1ffd: PortDecoding{0xf002, 0x1000}, FloatingBus: FLOATING_BUS_PLUS3}
+	PagingPentagon = Paging{Port7ffd: PortDecoding{0x8002, 0x0000}, FloatingBus: FLOATING_BUS_NONE}
+)
+
+func (d PortDecoding) Present() bool {
+	return d.Mask != 0
+}
 
 type Ula struct {
-	Beeper    *Beeper
-	Ay_3_8912 *AY_3_8912
-	Tape      *Tape
+	Beeper *Beeper
+	Tape   *Tape
+
+	ram    *Ram
+	timing Timing
 
-	ram *Ram
+	// T-state of the current frame, used for the floating bus.
+	FrameTState func() int
 
 	Frames int
 
+	Paging     Paging
 	Is128K     bool
 	Last0x7ffd uint8
+	Last0x1ffd uint8
 
 	VRamBank    int
 	BorderColor uint8
 
+	// Colours of the rendered frames, changes take effect at the end of the
+	// frame.
+	Palette Palette
+
+	// Optional ULAplus palette and Timex screen modes, nil when not
+	// attached.
+	UlaPlus *UlaPlus
+	Timex   *Timex
+
+	// Last finished frame, the next one is being generated into screen
+	// (see Update).
+	Frame     *Screen
+	screen    *Screen
+	screenRes Resolution
+	nextCell  int
+	snow      []snowEvent // Snow of the current frame, see Snow.
+
 	Keyboard [8]uint8
 }
 
-func (ula *Ula) Init(ram *Ram, beeper *Beeper, sound *AY_3_8912, is128k bool) {
+func (ula *Ula) Init(ram *Ram, beeper *Beeper, paging Paging, timing Timing) error {
 	ula.Beeper = beeper
-	ula.Ay_3_8912 = sound
 	ula.Tape = &Tape{}
 	ula.ram = ram
-	ula.Is128K = is128k
+	ula.timing = timing
+	ula.Paging = paging
+	ula.Is128K = paging.Port7ffd.Present()
 
-	ula.VRamBank = BANK_VRAM
+	ula.FrameTState = func() int { return 0 }
+	ula.Palette = PaletteDefault
+
+	if err := ula.SetScreenRes(ScreenRes); err != nil {
+		return err
+	}
+	ula.Reset()
 
 	for i := range ula.Keyboard {
 		ula.Keyboard[i] = 0b11111
 	}
+
+	return nil
 }
 
-func (ula *Ula) Write(addr uint16, value uint8) {
-	al, ah := helpers.To8(addr)
-
-	switch al {
-	case 0xfe:
-		ula.BorderColor = value & 0b00000111
-		if !ula.Tape.Running {
-			bit := (value & 0b10000) != 0
-			ula.Beeper.Beep(bit)
-			ula.Tape.earBit = bit
-		}
-	case 0xfd:
-		if ula.Is128K {
-			switch ah {
-			case 0x7f:
-				ula.Last0x7ffd = value
-
-				// Bit 0-2: bank select for page 0xc000
-				ula.ram.SetPageBank(3, int(value&0b111))
-				// Bit 3: 0=VRAM, 1=Shadow VRAM
-				if value&0b1000 == 0 {
-					ula.VRamBank = BANK_VRAM
-				} else {
-					ula.VRamBank = BANK_VRAM_SHADOW
-				}
-				// Bit 4: ROM select
-				ula.ram.SetRom(int(value&0b10000) >> 4)
-				// Bit 5: Disable pagging until reset.
-				if value&0b100000 != 0 {
-					ula.ram.SetPagingEnabled(false)
-				}
-
-			case 0xff: // AY-3-8912 sound chip
-				ula.Ay_3_8912.SelectRegister(value)
-			case 0xbf: // AY-3-8912 sound chip
-				ula.Ay_3_8912.Write(value)
-			}
+// Timing returns frame timing of the ULA.
+func (ula *Ula) Timing() Timing {
+	return ula.timing
+}
+
+func (ula *Ula) Attach(bus *IoBus) {
+	bus.Register(0x0001, 0x0000, ula.Read, ula.Write)
+
+	if port := ula.Paging.Port7ffd; port.Present() {
+		bus.Register(port.Mask, port.Value, nil, func(addr uint16, value uint8) { ula.Write7ffd(value) })
+	}
+	if port := ula.Paging.Port1ffd; port.Present() {
+		bus.Register(port.Mask, port.Value, nil, func(addr uint16, value uint8) { ula.Write1ffd(value) })
+	}
+
+	bus.Floating = ula.portFloatingBus
+}
+
+func (ula *Ula) Reset() {
+	ula.VRamBank = BANK_VRAM
+	ula.Last0x7ffd = 0
+	ula.Last0x1ffd = 0
+	ula.nextCell = 0
+
+	if ula.UlaPlus != nil {
+		ula.UlaPlus.Reset()
+	}
+	if ula.Timex != nil {
+		ula.Timex.Reset()
+	}
+}
+
+func (ula *Ula) Write7ffd(value uint8) {
+	if !ula.ram.PagingEnabled() {
+		return
+	}
+
+	ula.Last0x7ffd = value
+
+	// Bit 0-2: bank select for page 0xc000
+	ula.ram.SetPageBank(3, int(value&0b111))
+	// Bit 3: 0=VRAM, 1=Shadow VRAM
+	if value&0b1000 == 0 {
+		ula.VRamBank = BANK_VRAM
+	} else {
+		ula.VRamBank = BANK_VRAM_SHADOW
+	}
+	// Bit 4: ROM select
+	ula.ram.SetRom(ula.romSelect())
+	// Bit 5: Disable pagging until reset.
+	if value&0b100000 != 0 {
+		ula.ram.SetPagingEnabled(false)
+	}
+}
+
+func (ula *Ula) Write1ffd(value uint8) {
+	if !ula.Paging.Port1ffd.Present() || !ula.ram.PagingEnabled() {
+		return
+	}
+
+	ula.Last0x1ffd = value
+
+	if value&0b1 != 0 {
+		// Bit 1-2: special paging configuration.
+		ula.ram.SetSpecialPaging(true, int(value>>1)&0b11)
+	} else {
+		ula.ram.SetSpecialPaging(false, 0)
+		// Bit 2: ROM select high bit.
+		ula.ram.SetRom(ula.romSelect())
+	}
+}
+
+func (ula *Ula) romSelect() int {
+	rom := int(ula.Last0x7ffd&0b10000) >> 4
+	if ula.Paging.Port1ffd.Present() {
+		rom |= int(ula.Last0x1ffd&0b100) >> 1
+	}
+	return rom
+}
+
+// FloatingBus returns byte the ULA is currently fetching (or 0xff), this is
+// what the CPU reads from unpopulated memory.
+func (ula *Ula) FloatingBus() uint8 {
+	if ula.Paging.FloatingBus == FLOATING_BUS_NONE {
+		return 0xff
+	}
+	return ula.timing.FloatingBus(ula.FrameTState(), ula.ram.Bank(ula.VRamBank))
+}
+
+// Value read from unattached port. 48K and 128K leak the byte the ULA is
+// currently fetching, +2A/+3 only on ports 0000xxxxxxxxxx01 with bit 0 set
+// and only while the paging is not locked. Pentagon has no floating bus.
+func (ula *Ula) portFloatingBus(addr uint16) uint8 {
+	if ula.Paging.FloatingBus == FLOATING_BUS_PLUS3 {
+		if addr&0xf003 == 0x0001 && ula.ram.PagingEnabled() {
+			return ula.timing.FloatingBus(ula.FrameTState(), ula.ram.Bank(ula.VRamBank)) | 0x1
 		}
+		return 0xff
 	}
+
+	return ula.FloatingBus()
 }
 
+// Port 0xfe write.
+func (ula *Ula) Write(addr uint16, value uint8) {
+	ula.BorderColor = value & 0b00000111
+	if !ula.Tape.Running {
+		bit := (value & 0b10000) != 0
+		ula.Beeper.Beep(bit)
+		ula.Tape.earBit = bit
+	}
+}
+
+// Port 0xfe read.
 func (ula *Ula) Read(addr uint16) uint8 {
 	_, ah := helpers.To8(addr)
 
-	b := uint8(0)
-
-	switch ah {
-	case 0xff:
-		b = ula.Ay_3_8912.Read()
-	case 0xfe:
-		b |= ula.Keyboard[0]
-	case 0xfd:
-		b |= ula.Keyboard[1]
-	case 0xfb:
-		b |= ula.Keyboard[2]
-	case 0xf7:
-		b |= ula.Keyboard[3]
-	case 0xef:
-		b |= ula.Keyboard[4]
-	case 0xdf:
-		b |= ula.Keyboard[5]
-	case 0xbf:
-		b |= ula.Keyboard[6]
-	case 0x7f:
-		b |= 0b10100000
-		if ula.Tape.EarBit() {
-			b |= (1 << 6)
+	b := uint8(0b10111111)
+	if ula.Tape.EarBit() {
+		b |= (1 << 6)
+	}
+
+	for row := range ula.Keyboard {
+		if ah&(1<<row) == 0 {
+			b &= 0b11100000 | ula.Keyboard[row]
 		}
-		b |= ula.Keyboard[7]
-	default:
-		b = 0xff
 	}
 
 	return b
 }
 
 func (ula *Ula) UpdateEndFrame() {
+	ula.endScreen()
 	ula.Frames = (ula.Frames + 1) % 32
 }
@@ -0,0 +1,82 @@
+package device
+
+// ULAplus programmable 64 colour palette.
+//
+// Register port 0xbf3b (write) selects the group and the register, data port
+// 0xff3b reads and writes the selected register:
+//
+//   +-------+-------+---------------------------------+
+//   | 7   6 | 5 - 0 |                                 |
+//   +-------+-------+---------------------------------+
+//   | 0   0 | entry | palette group, entry 0-63       |
+//   | 0   1 |   -   | mode group, bit 0 palette on    |
+//   +-------+-------+---------------------------------+
+//
+// Palette entry is GGGRRRBB. In palette mode the attribute selects one of 4
+// CLUTs by FLASH and BRIGHT bits, ink is entry CLUT*16+INK, paper is
+// CLUT*16+8+PAPER, the border uses paper colours of CLUT 0.
+
+const (
+	ULAPLUS_GROUP_PALETTE = 0b00
+	ULAPLUS_GROUP_MODE    = 0b01
+)
+
+type UlaPlus struct {
+	Palette  [64]uint8
+	Mode     uint8
+	Register uint8 // Last value written into the register port.
+}
+
+func (u *UlaPlus) Attach(bus *IoBus) {
+	bus.Register(0xffff, 0xbf3b, nil, u.WriteRegister)
+	bus.Register(0xffff, 0xff3b, u.Read, u.Write)
+}
+
+func (u *UlaPlus) Reset() {
+	u.Mode = 0
+	u.Register = 0
+}
+
+// Enabled returns true in palette mode.
+func (u *UlaPlus) Enabled() bool {
+	return u != nil && u.Mode&0b1 != 0
+}
+
+func (u *UlaPlus) WriteRegister(addr uint16, value uint8) {
+	u.Register = value
+}
+
+func (u *UlaPlus) Write(addr uint16, value uint8) {
+	switch u.Register >> 6 {
+	case ULAPLUS_GROUP_PALETTE:
+		u.Palette[u.Register&0b111111] = value
+	case ULAPLUS_GROUP_MODE:
+		u.Mode = value
+	}
+}
+
+func (u *UlaPlus) Read(addr uint16) uint8 {
+	switch u.Register >> 6 {
+	case ULAPLUS_GROUP_PALETTE:
+		return u.Palette[u.Register&0b111111]
+	case ULAPLUS_GROUP_MODE:
+		return u.Mode
+	}
+
+	return 0xff
+}
+
+// UlaPlusColor converts palette entry GGGRRRBB to RGB, blue gets the third
+// bit as OR of the other two.
+func UlaPlusColor(entry uint8) RGB {
+	expand := func(v uint8) uint8 {
+		return v<<5 | v<<2 | v>>1
+	}
+
+	g := entry >> 5
+	r := (entry >> 2) & 0b111
+	b := entry & 0b11
+	b = b<<1 | (b>>1|b)&0b1
+
+	return RGB{expand(r), expand(g), expand(b)}
+}
@@ -0,0 +1,337 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Uncompressed AVI 1.0 with one video stream (24-bit bottom-up DIB frames)
+// and one PCM audio stream:
+//
+//	RIFF 'AVI '
+//	    LIST 'hdrl'
+//	        'avih'  main header
+//	        LIST 'strl'  'strh' + 'strf' (BITMAPINFOHEADER)
+//	        LIST 'strl'  'strh' + 'strf' (WAVEFORMAT)
+//	    LIST 'movi'
+//	        '00db'  frame
+//	        '01wb'  audio of the frame
+//	        ...
+//	    'idx1'  index of the chunks
+//
+// Counts and sizes are written when the writer is closed. Without OpenDML
+// extension the file is limited to 2 GiB, about 3 minutes of 320x240 video.
+
+const (
+	aviMaxSize       = math.MaxInt32
+	aviHasIndex      = 0x10
+	aviIsInterleaved = 0x100
+	aviKeyFrame      = 0x10
+)
+
+type aviMainHeader struct {
+	MicroSecPerFrame    uint32
+	MaxBytesPerSec      uint32
+	PaddingGranularity  uint32
+	Flags               uint32
+	TotalFrames         uint32
+	InitialFrames       uint32
+	Streams             uint32
+	SuggestedBufferSize uint32
+	Width               uint32
+	Height              uint32
+	Reserved            [4]uint32
+}
+
+type aviStreamHeader struct {
+	Type                [4]byte
+	Handler             [4]byte
+	Flags               uint32
+	Priority            uint16
+	Language            uint16
+	InitialFrames       uint32
+	Scale               uint32
+	Rate                uint32
+	Start               uint32
+	Length              uint32
+	SuggestedBufferSize uint32
+	Quality             int32
+	SampleSize          uint32
+	Frame               [4]int16
+}
+
+type aviBitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+type aviVideoList struct {
+	List   [4]byte
+	Size   uint32
+	Strl   [4]byte
+	Strh   [4]byte
+	HSize  uint32
+	Header aviStreamHeader
+	Strf   [4]byte
+	FSize  uint32
+	Format aviBitmapInfoHeader
+}
+
+type aviAudioList struct {
+	List   [4]byte
+	Size   uint32
+	Strl   [4]byte
+	Strh   [4]byte
+	HSize  uint32
+	Header aviStreamHeader
+	Strf   [4]byte
+	FSize  uint32
+	Format WaveFormat
+}
+
+type aviHeader struct {
+	Riff     [4]byte
+	RiffSize uint32
+	Avi      [4]byte
+	Hdrl     [4]byte
+	HdrlSize uint32
+	HdrlId   [4]byte
+	Avih     [4]byte
+	AvihSize uint32
+	Main     aviMainHeader
+	Video    aviVideoList
+	Audio    aviAudioList
+	Movi     [4]byte
+	MoviSize uint32
+	MoviId   [4]byte
+}
+
+type aviIndexEntry struct {
+	Id     [4]byte
+	Flags  uint32
+	Offset uint32
+	Size   uint32
+}
+
+type AviWriter struct {
+	file   io.WriteSeeker
+	writer *bufio.Writer
+	header aviHeader
+	index  []aviIndexEntry
+	frame  []byte
+	stride int
+	size   uint32 // Size of the 'movi' list content.
+}
+
+// NewAviWriter writes headers of the AVI file, frame rate is rateNum/rateDen
+// frames per second.
+func NewAviWriter(file io.WriteSeeker, width, height int, rateNum, rateDen int, audio WaveFormat) (*AviWriter, error) {
+	stride := (3*width + 3) &^ 3
+	frameSize := stride * height
+	audioSize := int(audio.BytesPerSec)*rateDen/rateNum + int(audio.BlockAlign)
+
+	w := &AviWriter{
+		file:   file,
+		writer: bufio.NewWriterSize(file, frameSize+audioSize+16),
+		frame:  make([]byte, frameSize),
+		stride: stride,
+		size:   4,
+	}
+
+	h := &w.header
+	h.Riff = [4]byte{'R', 'I', 'F', 'F'}
+	h.Avi = [4]byte{'A', 'V', 'I', ' '}
+	h.Hdrl = [4]byte{'L', 'I', 'S', 'T'}
+	h.HdrlSize = uint32(4 + 8 + binary.Size(h.Main) + binary.Size(h.Video) + binary.Size(h.Audio))
+	h.HdrlId = [4]byte{'h', 'd', 'r', 'l'}
+	h.Avih = [4]byte{'a', 'v', 'i', 'h'}
+	h.AvihSize = uint32(binary.Size(h.Main))
+	h.Main = aviMainHeader{
+		MicroSecPerFrame:    uint32(math.Round(1e6 * float64(rateDen) / float64(rateNum))),
+		MaxBytesPerSec:      uint32((frameSize+audioSize)*rateNum/rateDen + 1),
+		Flags:               aviHasIndex | aviIsInterleaved,
+		Streams:             2,
+		SuggestedBufferSize: uint32(frameSize + 8),
+		Width:               uint32(width),
+		Height:              uint32(height),
+	}
+
+	h.Video = aviVideoList{
+		List:  [4]byte{'L', 'I', 'S', 'T'},
+		Size:  uint32(binary.Size(h.Video) - 8),
+		Strl:  [4]byte{'s', 't', 'r', 'l'},
+		Strh:  [4]byte{'s', 't', 'r', 'h'},
+		HSize: uint32(binary.Size(h.Video.Header)),
+		Header: aviStreamHeader{
+			Type:                [4]byte{'v', 'i', 'd', 's'},
+			Handler:             [4]byte{'D', 'I', 'B', ' '},
+			Scale:               uint32(rateDen),
+			Rate:                uint32(rateNum),
+			SuggestedBufferSize: uint32(frameSize),
+			Quality:             -1,
+			Frame:               [4]int16{0, 0, int16(width), int16(height)},
+		},
+		Strf:  [4]byte{'s', 't', 'r', 'f'},
+		FSize: uint32(binary.Size(h.Video.Format)),
+		Format: aviBitmapInfoHeader{
+			Size:      uint32(binary.Size(h.Video.Format)),
+			Width:     int32(width),
+			Height:    int32(height),
+			Planes:    1,
+			BitCount:  24,
+			SizeImage: uint32(frameSize),
+		},
+	}
+
+	h.Audio = aviAudioList{
+		List:  [4]byte{'L', 'I', 'S', 'T'},
+		Size:  uint32(binary.Size(h.Audio) - 8),
+		Strl:  [4]byte{'s', 't', 'r', 'l'},
+		Strh:  [4]byte{'s', 't', 'r', 'h'},
+		HSize: uint32(binary.Size(h.Audio.Header)),
+		Header: aviStreamHeader{
+			Type:                [4]byte{'a', 'u', 'd', 's'},
+			Scale:               uint32(audio.BlockAlign),
+			Rate:                audio.BytesPerSec,
+			SuggestedBufferSize: uint32(audioSize),
+			Quality:             -1,
+			SampleSize:          uint32(audio.BlockAlign),
+		},
+		Strf:   [4]byte{'s', 't', 'r', 'f'},
+		FSize:  uint32(binary.Size(audio)),
+		Format: audio,
+	}
+
+	h.Movi = [4]byte{'L', 'I', 'S', 'T'}
+	h.MoviId = [4]byte{'m', 'o', 'v', 'i'}
+
+	if err := w.writeHeader(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *AviWriter) writeHeader() error {
+	w.header.MoviSize = w.size
+	w.header.RiffSize = uint32(binary.Size(w.header)) - 8 + w.size - 4 + w.indexSize()
+
+	return binary.Write(w.writer, binary.LittleEndian, &w.header)
+}
+
+func (w *AviWriter) indexSize() uint32 {
+	return uint32(8 + binary.Size(aviIndexEntry{})*len(w.index))
+}
+
+func (w *AviWriter) writeChunk(id [4]byte, data []byte) error {
+	size := uint32(len(data))
+	padded := size + size&1
+
+	if int64(binary.Size(w.header))+int64(w.size)+int64(w.indexSize())+int64(padded)+24 > aviMaxSize {
+		return errors.New("AVI file size limit reached")
+	}
+
+	if err := binary.Write(w.writer, binary.LittleEndian, struct {
+		Id   [4]byte
+		Size uint32
+	}{id, size}); err != nil {
+		return err
+	}
+
+	if _, err := w.writer.Write(data); err != nil {
+		return err
+	}
+
+	if padded != size {
+		if err := w.writer.WriteByte(0); err != nil {
+			return err
+		}
+	}
+
+	w.index = append(w.index, aviIndexEntry{Id: id, Flags: aviKeyFrame, Offset: w.size, Size: size})
+	w.size += 8 + padded
+	return nil
+}
+
+// WriteFrame converts RGBA frame (device.PIXEL_FORMAT_RGBA) of the video
+// size to bottom-up BGR.
+func (w *AviWriter) WriteFrame(rgba []byte, pitch int) error {
+	main := &w.header.Main
+	width, height := int(main.Width), int(main.Height)
+
+	for row := 0; row < height; row++ {
+		src := rgba[row*pitch:]
+		dst := w.frame[(height-1-row)*w.stride:]
+		for col := 0; col < width; col++ {
+			dst[3*col], dst[3*col+1], dst[3*col+2] = src[4*col+2], src[4*col+1], src[4*col]
+		}
+	}
+
+	if err := w.writeChunk([4]byte{'0', '0', 'd', 'b'}, w.frame); err != nil {
+		return err
+	}
+
+	main.TotalFrames++
+	w.header.Video.Header.Length++
+	return nil
+}
+
+// WriteAudio adds raw samples following the last frame.
+func (w *AviWriter) WriteAudio(samples []byte) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	if err := w.writeChunk([4]byte{'0', '1', 'w', 'b'}, samples); err != nil {
+		return err
+	}
+
+	w.header.Audio.Header.Length += uint32(len(samples)) / uint32(w.header.Audio.Format.BlockAlign)
+	return nil
+}
+
+// Close writes index and updates the headers. The underlying file is not
+// closed.
+func (w *AviWriter) Close() error {
+	if err := binary.Write(w.writer, binary.LittleEndian, struct {
+		Id   [4]byte
+		Size uint32
+	}{[4]byte{'i', 'd', 'x', '1'}, w.indexSize() - 8}); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w.writer, binary.LittleEndian, w.index); err != nil {
+		return err
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	_, err := w.file.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,150 @@
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// AY music file (ZXAYEMUL), code and data of the player with Z80 entry
+// points. Numbers are big endian, pointers are signed 16-bit offsets from
+// the position of the pointer itself:
+//
+//	Offset  Length  Description
+//	0       8       "ZXAYEMUL"
+//	8       1       File version
+//	9       1       Required player version
+//	10      2       Pointer to special player (unused)
+//	12      2       Pointer to author
+//	14      2       Pointer to misc text
+//	16      1       Number of songs - 1
+//	17      1       First song
+//	18      2       Pointer to songs
+//
+//	Song:   2 pointer to name, 2 pointer to song data
+//	Data:   4 channel mapping, 2 length (1/50 s), 2 fade length,
+//	        1 high byte of registers, 1 low byte of registers,
+//	        2 pointer to points, 2 pointer to blocks
+//	Points: 2 stack, 2 init, 2 interrupt
+//	Blocks: 2 address, 2 length, 2 pointer to data; address 0 ends
+
+type AyBlock struct {
+	Address uint16
+	Data    []byte
+}
+
+type AySong struct {
+	Name      string
+	Length    int // Frames (1/50 s), 0 unknown.
+	Fade      int // Frames.
+	HiReg     uint8
+	LoReg     uint8
+	Stack     uint16
+	Init      uint16
+	Interrupt uint16
+	Blocks    []AyBlock
+}
+
+type AyFile struct {
+	Author    string
+	Misc      string
+	FirstSong int
+	Songs     []AySong
+}
+
+type ayReader struct {
+	data []byte
+	err  error
+}
+
+func (r *ayReader) u8(offset int) uint8 {
+	if offset < 0 || offset >= len(r.data) {
+		r.err = errors.New("Truncated AY file")
+		return 0
+	}
+	return r.data[offset]
+}
+
+func (r *ayReader) u16(offset int) uint16 {
+	return uint16(r.u8(offset))<<8 | uint16(r.u8(offset+1))
+}
+
+// Target of the relative pointer at offset.
+func (r *ayReader) pointer(offset int) int {
+	return offset + int(int16(r.u16(offset)))
+}
+
+func (r *ayReader) text(offset int) string {
+	end := offset
+	for end >= 0 && end < len(r.data) && r.data[end] != 0 {
+		end++
+	}
+	if offset < 0 || end > len(r.data) {
+		r.err = errors.New("Truncated AY file")
+		return ""
+	}
+	return string(r.data[offset:end])
+}
+
+func LoadAy(reader io.Reader) (*AyFile, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 20 || string(data[0:8]) != "ZXAYEMUL" {
+		return nil, errors.New("Not an AY (ZXAYEMUL) file")
+	}
+
+	r := &ayReader{data: data}
+	ay := &AyFile{
+		Author:    r.text(r.pointer(12)),
+		Misc:      r.text(r.pointer(14)),
+		FirstSong: int(r.u8(17)),
+	}
+
+	songs := r.pointer(18)
+	for i := 0; i <= int(r.u8(16)) && r.err == nil; i++ {
+		entry := songs + 4*i
+		data := r.pointer(entry + 2)
+
+		song := AySong{
+			Name:   r.text(r.pointer(entry)),
+			Length: int(r.u16(data + 4)),
+			Fade:   int(r.u16(data + 6)),
+			HiReg:  r.u8(data + 8),
+			LoReg:  r.u8(data + 9),
+		}
+
+		points := r.pointer(data + 10)
+		song.Stack, song.Init, song.Interrupt = r.u16(points), r.u16(points+2), r.u16(points+4)
+
+		for block := r.pointer(data + 12); r.err == nil; block += 6 {
+			address := r.u16(block)
+			if address == 0 {
+				break
+			}
+
+			length, offset := int(r.u16(block+2)), r.pointer(block+4)
+			if offset < 0 || offset >= len(r.data) {
+				return nil, fmt.Errorf("Invalid AY block at 0x%04x", address)
+			}
+
+			// Blocks are truncated at the end of file and of the memory.
+			length = min(length, min(len(r.data)-offset, 0x10000-int(address)))
+			song.Blocks = append(song.Blocks, AyBlock{Address: address, Data: r.data[offset : offset+length]})
+		}
+
+		ay.Songs = append(ay.Songs, song)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if ay.FirstSong >= len(ay.Songs) {
+		ay.FirstSong = 0
+	}
+
+	return ay, nil
+}
@@ -0,0 +1,109 @@
+package formats
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"math"
+)
+
+// Animated GIF built from frames of palette indexes. Each frame after the
+// first one is stored as the rectangle of pixels changed since the previous
+// frame, unchanged pixels inside it are transparent and frames without
+// change extend the delay of the previous one.
+
+type GifWriter struct {
+	width       int
+	height      int
+	palette     color.Palette
+	transparent uint8
+
+	anim  gif.GIF
+	last  []uint8 // Composed picture after the last frame.
+	time  float64 // Total time in 1/100 s.
+	delay float64 // Time of the last frame end in 1/100 s.
+}
+
+// NewGifWriter creates GIF of the given size. Palette has to leave one free
+// entry for transparency.
+func NewGifWriter(width, height int, palette color.Palette) *GifWriter {
+	w := &GifWriter{
+		width:       width,
+		height:      height,
+		transparent: uint8(len(palette)),
+	}
+
+	w.palette = append(color.Palette{}, palette...)
+	w.palette = append(w.palette, color.RGBA{})
+	w.anim.Config = image.Config{ColorModel: w.palette, Width: width, Height: height}
+
+	return w
+}
+
+// AddFrame adds frame of palette indexes (width*height) shown for duration
+// seconds.
+func (w *GifWriter) AddFrame(pixels []uint8, duration float64) {
+	w.time += 100 * duration
+
+	rect := image.Rect(0, 0, w.width, w.height)
+	if w.last != nil {
+		rect = w.changed(pixels)
+		if rect.Empty() {
+			w.extendLast()
+			return
+		}
+	} else {
+		w.last = make([]uint8, len(pixels))
+	}
+
+	img := image.NewPaletted(rect, w.palette)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := y*w.width + x
+			if len(w.anim.Image) > 0 && pixels[i] == w.last[i] {
+				img.Pix[img.PixOffset(x, y)] = w.transparent
+			} else {
+				img.Pix[img.PixOffset(x, y)] = pixels[i]
+			}
+		}
+	}
+	copy(w.last, pixels)
+
+	w.anim.Image = append(w.anim.Image, img)
+	w.anim.Delay = append(w.anim.Delay, 0)
+	w.anim.Disposal = append(w.anim.Disposal, gif.DisposalNone)
+	w.extendLast()
+}
+
+// Delays are rounded from the total time, so the animation does not drift.
+func (w *GifWriter) extendLast() {
+	last := len(w.anim.Delay) - 1
+	delay := math.Round(w.time) - math.Round(w.delay)
+	w.anim.Delay[last] += int(delay)
+	w.delay += delay
+}
+
+// Bounding rectangle of the pixels changed since the last frame.
+func (w *GifWriter) changed(pixels []uint8) image.Rectangle {
+	rect := image.Rectangle{}
+	for y := 0; y < w.height; y++ {
+		row, last := pixels[y*w.width:(y+1)*w.width], w.last[y*w.width:(y+1)*w.width]
+		for x := 0; x < w.width; x++ {
+			if row[x] != last[x] {
+				rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return rect
+}
+
+func (w *GifWriter) Frames() int {
+	return len(w.anim.Image)
+}
+
+// Save encodes the animation, it loops forever.
+func (w *GifWriter) Save(writer io.Writer) error {
+	return gif.EncodeAll(writer, &w.anim)
+}
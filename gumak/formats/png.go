@@ -0,0 +1,16 @@
+package formats
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"mutex/gumak/device"
+)
+
+// SavePng writes frame generated by the ULA (border included) as PNG.
+func SavePng(writer io.Writer, frame *device.Screen) error {
+	img := image.NewRGBA(image.Rect(0, 0, frame.Res.W, frame.Res.H))
+	device.ConvertFrame(img.Pix, img.Stride, device.PIXEL_FORMAT_RGBA, frame)
+
+	return png.Encode(writer, img)
+}
@@ -0,0 +1,127 @@
+package formats
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// PSG log of AY register writes:
+//
+//	Offset  Length  Description
+//	0       4       "PSG", 0x1a
+//	4       1       Version
+//	5       1       Interrupt frequency (0 = 50 Hz)
+//	6       10      Unused
+//	16      -       Data
+//
+//	Data:   0x00-0x0f reg, value   register write
+//	        0xff                   end of frame (interrupt)
+//	        0xfe n                 end of n*4 frames
+//	        0xfd                   end of music
+
+const (
+	psgHeaderSize = 16
+	psgEndFrame   = 0xff
+	psgEndFrames  = 0xfe
+	psgEnd        = 0xfd
+)
+
+// Register write of AY log.
+type AyWrite struct {
+	Reg   uint8
+	Value uint8
+}
+
+// SavePsg writes register writes of the frames.
+func SavePsg(writer io.Writer, frames [][]AyWrite) error {
+	w := bufio.NewWriter(writer)
+
+	header := [psgHeaderSize]byte{'P', 'S', 'G', 0x1a, 0x10}
+	w.Write(header[:])
+
+	empty := 0
+	flushEmpty := func() {
+		for ; empty >= 4; empty -= 4 * min(empty/4, 0xff) {
+			w.Write([]byte{psgEndFrames, uint8(min(empty/4, 0xff))})
+		}
+		for ; empty > 0; empty-- {
+			w.WriteByte(psgEndFrame)
+		}
+	}
+
+	for _, frame := range frames {
+		if len(frame) == 0 {
+			empty++
+			continue
+		}
+
+		flushEmpty()
+		for _, write := range frame {
+			w.Write([]byte{write.Reg, write.Value})
+		}
+		w.WriteByte(psgEndFrame)
+	}
+	flushEmpty()
+
+	w.WriteByte(psgEnd)
+	return w.Flush()
+}
+
+// LoadPsg reads register writes of the frames.
+func LoadPsg(reader io.Reader) ([][]AyWrite, error) {
+	r := bufio.NewReader(reader)
+
+	var header [psgHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[0:4]) != "PSG\x1a" {
+		return nil, errors.New("Not a PSG file")
+	}
+
+	frames := [][]AyWrite{}
+	var frame []AyWrite
+
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF || b == psgEnd {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case b == psgEndFrame:
+			frames = append(frames, frame)
+			frame = nil
+		case b == psgEndFrames:
+			n, err := r.ReadByte()
+			if err != nil {
+				return nil, errors.New("Truncated PSG file")
+			}
+			for i := 0; i < 4*int(n); i++ {
+				frames = append(frames, frame)
+				frame = nil
+			}
+		case b < YM_REGISTERS:
+			value, err := r.ReadByte()
+			if err != nil {
+				return nil, errors.New("Truncated PSG file")
+			}
+			frame = append(frame, AyWrite{Reg: b, Value: value})
+		default:
+			return nil, errors.New("Invalid PSG data")
+		}
+	}
+
+	if frame != nil {
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,32 @@
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mutex/gumak/device"
+)
+
+// SCR screen file, plain copy of the bitmap (6144 bytes) and attributes (768
+// bytes) of the displayed VRAM bank.
+const SCR_SIZE = 6912
+
+func LoadScr(reader io.Reader, ula *device.Ula, ram *device.Ram) error {
+	data := make([]byte, SCR_SIZE+1)
+	size, err := io.ReadFull(reader, data)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	if size != SCR_SIZE {
+		return fmt.Errorf("Invalid screen size %d, expected %d", size, SCR_SIZE)
+	}
+
+	ram.SetBankContent(ula.VRamBank, data[:SCR_SIZE], 0)
+	return nil
+}
+
+func SaveScr(writer io.Writer, ula *device.Ula, ram *device.Ram) error {
+	_, err := writer.Write(ram.Bank(ula.VRamBank)[:SCR_SIZE])
+	return err
+}
@@ -19,6 +19,8 @@ func NewSnapshot(filename string) (SnapshotLoader, error) {
 		return &SNA{}, nil
 	case ".z80":
 		return &Z80{}, nil
+	case ".szx":
+		return &SZX{}, nil
 	}
 
 	return nil, errors.New("Invalid snapshot format")
@@ -0,0 +1,397 @@
+package formats
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mutex/gumak/device"
+	"mutex/gumak/log"
+	"mutex/gumak/z80"
+)
+
+// SZX (ZX-State) snapshot, header followed by chunks:
+//
+//	Offset  Length  Description
+//	0       4       "ZXST"
+//	4       1       Major version (1)
+//	5       1       Minor version (4)
+//	6       1       Machine id
+//	7       1       Flags
+//
+//	Chunk:  4 bytes id, 4 bytes (LE) size, data
+//
+// Supported chunks are Z80R (registers), SPCR (ULA ports), RAMP (16K RAM
+// banks), PLTT (ULAplus palette) and SCLD (Timex port 0xff), other chunks
+// are skipped.
+
+const (
+	SZX_MACHINE_16K      = 0
+	SZX_MACHINE_48K      = 1
+	SZX_MACHINE_128K     = 2
+	SZX_MACHINE_PLUS2    = 3
+	SZX_MACHINE_PLUS2A   = 4
+	SZX_MACHINE_PLUS3    = 5
+	SZX_MACHINE_PLUS3E   = 6
+	SZX_MACHINE_PENTAGON = 7
+	SZX_MACHINE_NTSC48K  = 15
+)
+
+const (
+	szxRamCompressed   = 0x1
+	szxPaletteEnabled  = 0x1
+	szxZ80Halted       = 0x2
+	szxPaletteChunkLen = 66
+)
+
+type SZX struct {
+	machineId uint8
+}
+
+type szxHeader struct {
+	Magic     [4]byte
+	Major     uint8
+	Minor     uint8
+	MachineId uint8
+	Flags     uint8
+}
+
+type szxZ80Regs struct {
+	AF, BC, DE, HL     uint16
+	AF_, BC_, DE_, HL_ uint16
+	IX, IY, SP, PC     uint16
+	I, R               uint8
+	IFF1, IFF2, IM     uint8
+	CyclesStart        uint32
+	HoldIntReqCycles   uint8
+	Flags              uint8
+	MemPtr             uint16
+}
+
+type szxSpectrumRegs struct {
+	Border   uint8
+	Out7ffd  uint8
+	Out1ffd  uint8
+	OutFe    uint8
+	Reserved [4]uint8
+}
+
+func pair(h, l uint8) uint16 {
+	return uint16(h)<<8 | uint16(l)
+}
+
+func unpair(v uint16) (h, l uint8) {
+	return uint8(v >> 8), uint8(v)
+}
+
+// Machine ID of the emulated hardware.
+func machineId(ula *device.Ula, ram *device.Ram) uint8 {
+	switch {
+	case ula.Paging == device.PagingPlus3:
+		return SZX_MACHINE_PLUS3
+	case ula.Paging == device.PagingPentagon:
+		return SZX_MACHINE_PENTAGON
+	case ula.Is128K:
+		return SZX_MACHINE_128K
+	case ram.PageAttributes(2)&device.PAGE_UNMAPPED != 0:
+		return SZX_MACHINE_16K
+	case ula.Timing() == device.Timing48KNtsc:
+		return SZX_MACHINE_NTSC48K
+	}
+	return SZX_MACHINE_48K
+}
+
+// Machine ID of the emulated hardware the snapshot runs on, +2 is 128K and
+// +2A/+3e is +3.
+func compatibleMachineId(id uint8) uint8 {
+	switch id {
+	case SZX_MACHINE_PLUS2:
+		return SZX_MACHINE_128K
+	case SZX_MACHINE_PLUS2A, SZX_MACHINE_PLUS3E:
+		return SZX_MACHINE_PLUS3
+	}
+	return id
+}
+
+func (s *SZX) Load(reader io.Reader, cpu *z80.CPU, ula *device.Ula, ram *device.Ram) error {
+	var header szxHeader
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("Invalid header: %w", err)
+	}
+
+	if string(header.Magic[:]) != "ZXST" {
+		return errors.New("Invalid header")
+	}
+
+	s.machineId = header.MachineId
+	if compatibleMachineId(s.machineId) != machineId(ula, ram) {
+		return fmt.Errorf("Snapshot of machine %d does not match emulated machine", s.machineId)
+	}
+
+	ram.Init()
+	cpu.Reset()
+
+	for {
+		var id [4]byte
+		var size uint32
+
+		if err := binary.Read(reader, binary.LittleEndian, &id); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+			return err
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return fmt.Errorf("Chunk %s: %w", id, err)
+		}
+
+		var err error
+		switch string(id[:]) {
+		case "Z80R":
+			err = s.loadRegs(data, cpu)
+		case "SPCR":
+			err = s.loadSpectrumRegs(data, ula)
+		case "RAMP":
+			err = s.loadRamPage(data, ram)
+		case "PLTT":
+			err = s.loadPalette(data, ula)
+		case "SCLD":
+			err = s.loadScld(data, ula)
+		default:
+			log.Debug("SZX: skipping chunk %s", id)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Chunk %s: %w", id, err)
+		}
+	}
+}
+
+func (s *SZX) loadRegs(data []byte, cpu *z80.CPU) error {
+	var regs szxZ80Regs
+	if len(data) < binary.Size(regs)-2 {
+		return errors.New("Invalid size")
+	}
+
+	// Memptr is missing in older versions.
+	data = append(data, 0, 0)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &regs)
+
+	r := &cpu.Reg
+	r.A, r.F = unpair(regs.AF)
+	r.B, r.C = unpair(regs.BC)
+	r.D, r.E = unpair(regs.DE)
+	r.H, r.L = unpair(regs.HL)
+	r.A_, r.F_ = unpair(regs.AF_)
+	r.B_, r.C_ = unpair(regs.BC_)
+	r.D_, r.E_ = unpair(regs.DE_)
+	r.H_, r.L_ = unpair(regs.HL_)
+	r.IX, r.IY, r.SP, r.PC = regs.IX, regs.IY, regs.SP, regs.PC
+	r.I = regs.I
+	r.R_write(regs.R)
+
+	cpu.IFF1 = regs.IFF1 != 0
+	cpu.IFF2 = regs.IFF2 != 0
+	cpu.InterruptMode = int(regs.IM)
+
+	if regs.Flags&szxZ80Halted != 0 {
+		log.Warning("SZX: halted CPU state is not restored")
+	}
+
+	return nil
+}
+
+func (s *SZX) loadSpectrumRegs(data []byte, ula *device.Ula) error {
+	var regs szxSpectrumRegs
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &regs); err != nil {
+		return err
+	}
+
+	ula.BorderColor = regs.Border & 0b111
+
+	if ula.Paging.Port1ffd.Present() {
+		ula.Write1ffd(regs.Out1ffd)
+	}
+	if ula.Is128K {
+		ula.Write7ffd(regs.Out7ffd)
+	}
+
+	return nil
+}
+
+func (s *SZX) loadRamPage(data []byte, ram *device.Ram) error {
+	if len(data) < 3 {
+		return errors.New("Invalid size")
+	}
+
+	flags := binary.LittleEndian.Uint16(data)
+	bank := int(data[2])
+	page := data[3:]
+
+	if flags&szxRamCompressed != 0 {
+		r, err := zlib.NewReader(bytes.NewReader(page))
+		if err != nil {
+			return err
+		}
+
+		page, err = io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(page) != 0x4000 || bank > 7 {
+		return fmt.Errorf("Invalid RAM page %d", bank)
+	}
+
+	ram.SetBankContent(bank, page, 0)
+	return nil
+}
+
+func (s *SZX) loadPalette(data []byte, ula *device.Ula) error {
+	if len(data) < szxPaletteChunkLen {
+		return errors.New("Invalid size")
+	}
+
+	if ula.UlaPlus == nil {
+		log.Warning("SZX: ULAplus is not attached, palette is ignored")
+		return nil
+	}
+
+	ula.UlaPlus.Mode = 0
+	if data[0]&szxPaletteEnabled != 0 {
+		ula.UlaPlus.Mode = 1
+	}
+	ula.UlaPlus.Register = data[1]
+	copy(ula.UlaPlus.Palette[:], data[2:66])
+
+	// Mode register was added in version 1.5.
+	if len(data) > szxPaletteChunkLen {
+		ula.UlaPlus.Mode = data[66]
+	}
+
+	ula.LatchPalette()
+	return nil
+}
+
+func (s *SZX) loadScld(data []byte, ula *device.Ula) error {
+	if len(data) < 2 {
+		return errors.New("Invalid size")
+	}
+
+	if ula.Timex == nil {
+		log.Warning("SZX: Timex screen is not attached, port 0xff is ignored")
+		return nil
+	}
+
+	// chOutF4, chOutFF
+	ula.Timex.Port = data[1]
+	return nil
+}
+
+func writeChunk(writer io.Writer, id string, data interface{}) error {
+	var buffer bytes.Buffer
+	if err := binary.Write(&buffer, binary.LittleEndian, data); err != nil {
+		return err
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, []byte(id)); err != nil {
+		return err
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, uint32(buffer.Len())); err != nil {
+		return err
+	}
+
+	_, err := writer.Write(buffer.Bytes())
+	return err
+}
+
+func (s *SZX) Save(writer io.Writer, cpu *z80.CPU, ula *device.Ula, ram *device.Ram) error {
+	header := szxHeader{Magic: [4]byte{'Z', 'X', 'S', 'T'}, Major: 1, Minor: 4}
+	header.MachineId = machineId(ula, ram)
+
+	if err := binary.Write(writer, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	r := &cpu.Reg
+	regs := szxZ80Regs{
+		AF: pair(r.A, r.F), BC: pair(r.B, r.C), DE: pair(r.D, r.E), HL: pair(r.H, r.L),
+		AF_: pair(r.A_, r.F_), BC_: pair(r.B_, r.C_), DE_: pair(r.D_, r.E_), HL_: pair(r.H_, r.L_),
+		IX: r.IX, IY: r.IY, SP: r.SP, PC: r.PC,
+		I: r.I, R: r.R_(),
+		IM: uint8(cpu.InterruptMode),
+	}
+	if cpu.IFF1 {
+		regs.IFF1 = 1
+	}
+	if cpu.IFF2 {
+		regs.IFF2 = 1
+	}
+
+	if err := writeChunk(writer, "Z80R", &regs); err != nil {
+		return err
+	}
+
+	spcr := szxSpectrumRegs{
+		Border:  ula.BorderColor,
+		Out7ffd: ula.Last0x7ffd,
+		Out1ffd: ula.Last0x1ffd,
+		OutFe:   ula.BorderColor,
+	}
+	if err := writeChunk(writer, "SPCR", &spcr); err != nil {
+		return err
+	}
+
+	var banks []int
+	switch header.MachineId {
+	case SZX_MACHINE_16K:
+		banks = []int{5}
+	case SZX_MACHINE_48K, SZX_MACHINE_NTSC48K:
+		banks = []int{5, 2, 0}
+	default:
+		banks = []int{0, 1, 2, 3, 4, 5, 6, 7}
+	}
+
+	for _, bank := range banks {
+		var compressed bytes.Buffer
+		z := zlib.NewWriter(&compressed)
+		z.Write(ram.Bank(bank))
+		z.Close()
+
+		page := append([]byte{szxRamCompressed, 0, uint8(bank)}, compressed.Bytes()...)
+		if err := writeChunk(writer, "RAMP", page); err != nil {
+			return err
+		}
+	}
+
+	if plus := ula.UlaPlus; plus != nil {
+		palette := make([]byte, szxPaletteChunkLen)
+		if plus.Enabled() {
+			palette[0] = szxPaletteEnabled
+		}
+		palette[1] = plus.Register
+		copy(palette[2:], plus.Palette[:])
+
+		if err := writeChunk(writer, "PLTT", palette); err != nil {
+			return err
+		}
+	}
+
+	if ula.Timex != nil {
+		if err := writeChunk(writer, "SCLD", []byte{0, ula.Timex.Port}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// WAV (RIFF WAVE) file with PCM samples:
+//
+//	Offset  Length  Description
+//	0       4       "RIFF"
+//	4       4       File size - 8
+//	8       4       "WAVE"
+//	12      4       "fmt "
+//	16      4       16 (format chunk size)
+//	20      16      WaveFormat
+//	36      4       "data"
+//	40      4       Data size
+//	44      -       Samples
+//
+// Sizes are unknown until the recording is finished, they are written when
+// the writer is closed.
+
+const wavHeaderSize = 44
+
+type WaveFormat struct {
+	FormatTag     uint16 // 1 = PCM
+	Channels      uint16
+	SamplesPerSec uint32
+	BytesPerSec   uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+func NewWaveFormat(rate, channels, bits int) WaveFormat {
+	return WaveFormat{
+		FormatTag:     1,
+		Channels:      uint16(channels),
+		SamplesPerSec: uint32(rate),
+		BytesPerSec:   uint32(rate * channels * bits / 8),
+		BlockAlign:    uint16(channels * bits / 8),
+		BitsPerSample: uint16(bits),
+	}
+}
+
+type WavWriter struct {
+	file   io.WriteSeeker
+	writer *bufio.Writer
+	format WaveFormat
+	size   uint32
+}
+
+// NewWavWriter writes header of WAV file, samples are added by Write and the
+// header is completed by Close.
+func NewWavWriter(file io.WriteSeeker, format WaveFormat) (*WavWriter, error) {
+	w := &WavWriter{file: file, writer: bufio.NewWriter(file), format: format}
+	if err := w.writeHeader(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *WavWriter) writeHeader() error {
+	header := struct {
+		Riff     [4]byte
+		RiffSize uint32
+		Wave     [4]byte
+		Fmt      [4]byte
+		FmtSize  uint32
+		Format   WaveFormat
+		Data     [4]byte
+		DataSize uint32
+	}{
+		Riff:     [4]byte{'R', 'I', 'F', 'F'},
+		RiffSize: wavHeaderSize - 8 + w.size + w.size&1,
+		Wave:     [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:      [4]byte{'f', 'm', 't', ' '},
+		FmtSize:  16,
+		Format:   w.format,
+		Data:     [4]byte{'d', 'a', 't', 'a'},
+		DataSize: w.size,
+	}
+
+	return binary.Write(w.writer, binary.LittleEndian, &header)
+}
+
+// Write adds raw samples, interleaved by channel.
+func (w *WavWriter) Write(samples []byte) (int, error) {
+	n, err := w.writer.Write(samples)
+	w.size += uint32(n)
+	return n, err
+}
+
+// Close updates sizes in the header. The underlying file is not closed.
+func (w *WavWriter) Close() error {
+	if w.size&1 != 0 {
+		// Chunks are word aligned.
+		if err := w.writer.WriteByte(0); err != nil {
+			return err
+		}
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	_, err := w.file.Seek(0, io.SeekEnd)
+	return err
+}
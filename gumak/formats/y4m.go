@@ -0,0 +1,67 @@
+package formats
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// YUV4MPEG2 uncompressed video stream, text header followed by frames:
+//
+//	YUV4MPEG2 W<width> H<height> F<num>:<den> Ip A1:1 C444 XCOLORRANGE=FULL
+//	FRAME
+//	<Y plane> <Cb plane> <Cr plane>
+//
+// Full resolution chroma (4:4:4) keeps the Spectrum colour clash sharp.
+
+type Y4mWriter struct {
+	writer *bufio.Writer
+	width  int
+	height int
+	planes []byte
+}
+
+// NewY4mWriter writes stream header, frame rate is rateNum/rateDen frames
+// per second.
+func NewY4mWriter(writer io.Writer, width, height int, rateNum, rateDen int) (*Y4mWriter, error) {
+	w := &Y4mWriter{
+		writer: bufio.NewWriterSize(writer, 3*width*height),
+		width:  width,
+		height: height,
+		planes: make([]byte, 3*width*height),
+	}
+
+	_, err := fmt.Fprintf(w.writer, "YUV4MPEG2 W%d H%d F%d:%d Ip A1:1 C444 XCOLORRANGE=FULL\n", width, height, rateNum, rateDen)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// WriteFrame converts RGBA frame (device.PIXEL_FORMAT_RGBA) of the stream
+// size to YCbCr.
+func (w *Y4mWriter) WriteFrame(rgba []byte, pitch int) error {
+	size := w.width * w.height
+	y, cb, cr := w.planes[:size], w.planes[size:2*size], w.planes[2*size:]
+
+	for row := 0; row < w.height; row++ {
+		line := rgba[row*pitch:]
+		for col := 0; col < w.width; col++ {
+			i := row*w.width + col
+			y[i], cb[i], cr[i] = color.RGBToYCbCr(line[4*col], line[4*col+1], line[4*col+2])
+		}
+	}
+
+	if _, err := w.writer.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+
+	_, err := w.writer.Write(w.planes)
+	return err
+}
+
+func (w *Y4mWriter) Close() error {
+	return w.writer.Flush()
+}
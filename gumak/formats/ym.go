@@ -0,0 +1,200 @@
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// YM5/YM6 register dump, uncompressed (YM files are usually packed by LHA,
+// players accept the raw file too). Numbers are big endian:
+//
+//	Offset  Length  Description
+//	0       4       "YM5!" or "YM6!"
+//	4       8       "LeOnArD!"
+//	12      4       Number of frames
+//	16      4       Attributes (bit 0: interleaved data)
+//	20      2       Number of digidrums (0)
+//	22      4       Chip clock in Hz
+//	26      2       Frame rate in Hz
+//	28      4       Loop frame
+//	32      2       Size of extra data (0)
+//	34      -       Song name, author, comment (zero terminated)
+//	-       16*n    Registers 0-15 of the frames, interleaved by register
+//	-       4       "End!"
+//
+// Register 13 is 0xff in frames which do not restart the envelope.
+//
+// YM3 files ("YM3!", "YM3b") have no header, only registers 0-13 of the
+// frames interleaved, 50 Hz at 2 MHz clock. "YM3b" ends with the loop frame.
+
+const (
+	YM_VERSION_3 = 3
+	YM_VERSION_5 = 5
+	YM_VERSION_6 = 6
+
+	YM_REGISTERS         = 16
+	YM_ENVELOPE_NO_WRITE = 0xff
+
+	ymInterleaved = 0x1
+
+	ymAtariClock = 2000000
+	ymRate       = 50
+	ym3Registers = 14
+)
+
+type ymHeader struct {
+	Magic      [4]byte
+	Check      [8]byte
+	Frames     uint32
+	Attributes uint32
+	Digidrums  uint16
+	Clock      uint32
+	Rate       uint16
+	Loop       uint32
+	ExtraSize  uint16
+}
+
+// Song of YM file.
+type YmSong struct {
+	Version int
+	Clock   uint32 // AY clock in Hz.
+	Rate    uint16 // Frames per second.
+	Name    string
+	Author  string
+	Comment string
+	Frames  [][YM_REGISTERS]uint8
+}
+
+// YmFrames converts register writes to per frame register dumps, initial
+// are the register values before the first frame.
+func YmFrames(initial [YM_REGISTERS]uint8, frames [][]AyWrite) [][YM_REGISTERS]uint8 {
+	regs := initial
+	dumps := make([][YM_REGISTERS]uint8, len(frames))
+
+	for i, frame := range frames {
+		regs[13] = YM_ENVELOPE_NO_WRITE
+		for _, write := range frame {
+			if write.Reg < YM_REGISTERS {
+				regs[write.Reg] = write.Value
+			}
+		}
+
+		// Effects of YM6 and YM5 are not used.
+		regs[14], regs[15] = 0, 0
+		dumps[i] = regs
+	}
+
+	return dumps
+}
+
+func SaveYm(writer io.Writer, song *YmSong) error {
+	if song.Version != YM_VERSION_5 && song.Version != YM_VERSION_6 {
+		return fmt.Errorf("Unsupported YM version %d", song.Version)
+	}
+
+	w := bufio.NewWriter(writer)
+
+	header := ymHeader{
+		Magic:      [4]byte{'Y', 'M', '0' + uint8(song.Version), '!'},
+		Check:      [8]byte{'L', 'e', 'O', 'n', 'A', 'r', 'D', '!'},
+		Frames:     uint32(len(song.Frames)),
+		Attributes: ymInterleaved,
+		Clock:      song.Clock,
+		Rate:       song.Rate,
+	}
+	if err := binary.Write(w, binary.BigEndian, &header); err != nil {
+		return err
+	}
+
+	for _, text := range []string{song.Name, song.Author, song.Comment} {
+		w.WriteString(text)
+		w.WriteByte(0)
+	}
+
+	for reg := 0; reg < YM_REGISTERS; reg++ {
+		for _, frame := range song.Frames {
+			w.WriteByte(frame[reg])
+		}
+	}
+
+	w.WriteString("End!")
+	return w.Flush()
+}
+
+// LoadYm reads uncompressed YM3, YM5 or YM6 file.
+func LoadYm(reader io.Reader) (*YmSong, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > 7 && string(data[2:7]) == "-lh5-" {
+		return nil, errors.New("Packed YM file, unpack it by LHA first")
+	} else if len(data) < 4 {
+		return nil, errors.New("Not a YM file")
+	}
+
+	switch string(data[0:4]) {
+	case "YM3!", "YM3b":
+		song := &YmSong{Version: YM_VERSION_3, Clock: ymAtariClock, Rate: ymRate}
+		return song, ymFrames(song, data[4:], len(data[4:])/ym3Registers, ym3Registers, true)
+	case "YM5!", "YM6!":
+	default:
+		return nil, errors.New("Unsupported YM file")
+	}
+
+	var header ymHeader
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil || string(header.Check[:]) != "LeOnArD!" {
+		return nil, errors.New("Invalid YM header")
+	}
+
+	song := &YmSong{Version: int(header.Magic[2] - '0'), Clock: header.Clock, Rate: header.Rate}
+
+	// Digidrums are not supported, skipped.
+	skip := int64(header.ExtraSize)
+	for i := 0; i < int(header.Digidrums); i++ {
+		var size uint32
+		r.Seek(skip, io.SeekCurrent)
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, errors.New("Truncated YM file")
+		}
+		skip = int64(size)
+	}
+	r.Seek(skip, io.SeekCurrent)
+
+	texts := bufio.NewReader(r)
+	for _, text := range []*string{&song.Name, &song.Author, &song.Comment} {
+		value, err := texts.ReadString(0)
+		if err != nil {
+			return nil, errors.New("Truncated YM file")
+		}
+		*text = value[:len(value)-1]
+	}
+
+	offset := len(data) - r.Len() - texts.Buffered()
+	return song, ymFrames(song, data[offset:], int(header.Frames), YM_REGISTERS, header.Attributes&ymInterleaved != 0)
+}
+
+func ymFrames(song *YmSong, data []byte, frames, registers int, interleaved bool) error {
+	if len(data) < frames*registers {
+		return errors.New("Truncated YM file")
+	}
+
+	song.Frames = make([][YM_REGISTERS]uint8, frames)
+	for i := range song.Frames {
+		for reg := 0; reg < registers; reg++ {
+			if interleaved {
+				song.Frames[i][reg] = data[reg*frames+i]
+			} else {
+				song.Frames[i][reg] = data[i*registers+reg]
+			}
+		}
+	}
+
+	return nil
+}
@@ -15,6 +15,7 @@ type Z80 struct {
 	header     [30]byte
 	header2    []byte
 	is128k     bool
+	isPlus3    bool
 }
 
 func decompressedSize(compressed []byte) int {
@@ -319,6 +320,7 @@ func (s *Z80) Load(reader io.Reader, cpu *z80.CPU, ula *device.Ula, ram *device.
 
 	s.version = 1
 	s.is128k = false
+	s.isPlus3 = false
 
 	cpu.Reg.A = s.header[0]
 	cpu.Reg.F = s.header[1]
@@ -429,6 +431,9 @@ func (s *Z80) Load(reader io.Reader, cpu *z80.CPU, ula *device.Ula, ram *device.
 		// 4               128k + If.1             128k
 		// 5               -                       128k + If.1
 		// 6               -                       128k + M.G.T.
+		// 7               Spectrum +3             Spectrum +3
+		// 9               Pentagon 128K           Pentagon 128K
+		// 13              Spectrum +2A            Spectrum +2A
 		if s.version == 2 {
 			switch s.header2[2] {
 			case 0:
@@ -436,22 +441,35 @@ func (s *Z80) Load(reader io.Reader, cpu *z80.CPU, ula *device.Ula, ram *device.
 			case 3:
 				s.is128k = true
 			default:
-				return errors.New(fmt.Sprintf("Unsupported hardware version: %d (file ver: %d)", s.header2[4], s.version))
+				return errors.New(fmt.Sprintf("Unsupported hardware version: %d (file ver: %d)", s.header2[2], s.version))
 			}
 		} else if s.version == 3 {
 			switch s.header2[2] {
 			case 0:
 				s.is128k = false
-			case 4:
+			case 4, 9:
+				s.is128k = true
+			case 7, 13:
 				s.is128k = true
+				s.isPlus3 = true
 			default:
-				return errors.New(fmt.Sprintf("Unsupported hardware version: %d (file ver: %d)", s.header2[4], s.version))
+				return errors.New(fmt.Sprintf("Unsupported hardware version: %d (file ver: %d)", s.header2[2], s.version))
 			}
 		}
 
+		if s.isPlus3 && !ula.Paging.Port1ffd.Present() {
+			return errors.New("Snapshot of +2A/+3 needs machine with port 0x1ffd")
+		}
+
+		// 86      1       Last OUT to 0x1ffd (+3 / +2A only)
+		if s.isPlus3 && len >= 55 {
+			out1ffd := s.header2[54]
+			ula.Write1ffd(out1ffd)
+		}
+
 		if s.is128k {
 			out7ffd := s.header2[3]
-			ula.Write(0x7ffd, out7ffd)
+			ula.Write7ffd(out7ffd)
 		}
 	}
 
@@ -465,6 +483,15 @@ func (s *Z80) Load(reader io.Reader, cpu *z80.CPU, ula *device.Ula, ram *device.
 func (s *Z80) Save(writer io.Writer, cpu *z80.CPU, ula *device.Ula, ram *device.Ram) error {
 	s.compressed = false
 	s.version = 2
+	s.is128k = ula.Is128K
+	s.isPlus3 = ula.Paging.Port1ffd.Present()
+
+	// Version 3 stores the last OUT to 0x1ffd.
+	header2Len := 23
+	if s.isPlus3 {
+		s.version = 3
+		header2Len = 55
+	}
 
 	s.header[0] = cpu.Reg.A
 	s.header[1] = cpu.Reg.F
@@ -500,16 +527,23 @@ func (s *Z80) Save(writer io.Writer, cpu *z80.CPU, ula *device.Ula, ram *device.
 
 	s.header[29] = uint8(cpu.InterruptMode)
 
-	s.header2 = make([]byte, 2+23)
-	s.header2[0], s.header2[1] = helpers.To8(23)
+	// Offsets in header2 are by 30 lower than in the file.
+	s.header2 = make([]byte, 2+header2Len)
+	s.header2[0], s.header2[1] = helpers.To8(uint16(header2Len))
 	s.header2[2], s.header2[3] = helpers.To8(cpu.Reg.PC)
 
-	if ula.Is128K {
+	switch {
+	case s.isPlus3:
+		s.header2[4] = 7
+		s.header2[56] = ula.Last0x1ffd
+	case s.is128k:
 		s.header2[4] = 3
-		s.header[5] = ula.Last0x7ffd
-	} else {
+	default:
 		s.header2[4] = 0
 	}
+	if s.is128k {
+		s.header2[5] = ula.Last0x7ffd
+	}
 
 	// TODO: Handle error
 	size, _ := writer.Write(s.header[:])
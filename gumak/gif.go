@@ -0,0 +1,151 @@
+package gumak
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+
+	"mutex/gumak/device"
+	"mutex/gumak/formats"
+	"mutex/gumak/log"
+)
+
+// Animated GIF capture of a fixed number of frames. The GIF uses the 15
+// distinct colours of the current palette (bright black is black), ULAplus
+// colours are mapped to the nearest of them.
+
+type gifRecorder struct {
+	filename string
+	writer   *formats.GifWriter
+	frames   int // Frames left to capture.
+	border   bool
+	duration float64
+	pixels   []uint8
+	palette  color.Palette
+	done     bool
+	err      error
+}
+
+// Colour index (see device.Palette) to GIF palette index.
+func gifColor(index uint8) uint8 {
+	switch {
+	case index == 8:
+		return 0
+	case index > 8:
+		return index - 1
+	}
+	return index
+}
+
+// StartGif captures seconds of emulated frames into animated GIF, with or
+// without the border. The file is written when the time elapses or by
+// StopGif.
+func (g *Gumak) StartGif(filename string, seconds float64, border bool) error {
+	if g.GifRecording() {
+		return fmt.Errorf("GIF recording already running")
+	}
+
+	frames := int(seconds*g.FrameRate() + 0.5)
+	if frames <= 0 {
+		return fmt.Errorf("Invalid GIF length %g s", seconds)
+	}
+
+	width, height := g.FrameResolution()
+	if !border {
+		width, height = device.DisplayRes.W, device.DisplayRes.H
+	}
+
+	r := &gifRecorder{
+		filename: filename,
+		frames:   frames,
+		border:   border,
+		duration: 1 / g.FrameRate(),
+		pixels:   make([]uint8, width*height),
+	}
+
+	for i, c := range g.Ula.Palette {
+		if i != 8 {
+			r.palette = append(r.palette, color.RGBA{c.R, c.G, c.B, 255})
+		}
+	}
+	r.writer = formats.NewGifWriter(width, height, r.palette)
+
+	log.Info("Recording GIF %s (%d frames)", filename, frames)
+	g.gif = r
+	return nil
+}
+
+// StopGif writes the GIF if not written yet, returns error of the writing.
+func (g *Gumak) StopGif() error {
+	if g.gif == nil {
+		return nil
+	}
+
+	r := g.gif
+	g.gif = nil
+
+	if !r.done {
+		r.save()
+	}
+	return r.err
+}
+
+func (g *Gumak) GifRecording() bool {
+	return g.gif != nil && !g.gif.done
+}
+
+func (r *gifRecorder) save() {
+	r.done = true
+
+	f, err := os.Create(r.filename)
+	if err == nil {
+		err = r.writer.Save(f)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+
+	if err != nil {
+		log.Error("Failed to save GIF %s: %s", r.filename, err)
+		r.err = err
+		return
+	}
+
+	log.Info("Saved GIF %s (%d frames)", r.filename, r.writer.Frames())
+}
+
+func (r *gifRecorder) addFrame(frame *device.Screen) {
+	if r.done {
+		return
+	}
+
+	width := len(r.pixels) / device.DisplayRes.H
+	x0, y0, w, h := 0, 0, frame.Res.W, frame.Res.H
+	if r.border {
+		width = len(r.pixels) / h
+	} else {
+		x0, y0, w, h = frame.DisplayArea()
+	}
+
+	// Hi-res frames are sampled down to the GIF width.
+	for y := 0; y < h; y++ {
+		src := frame.Pixels[(y0+y)*frame.Res.W+x0:]
+		dst := r.pixels[y*width : (y+1)*width]
+		for x := range dst {
+			index := src[x*w/width]
+			if index >= device.SCREEN_ULAPLUS {
+				rgb := device.UlaPlusColor(frame.UlaPlus[index-device.SCREEN_ULAPLUS])
+				dst[x] = uint8(r.palette.Index(color.RGBA{rgb.R, rgb.G, rgb.B, 255}))
+			} else {
+				dst[x] = gifColor(index)
+			}
+		}
+	}
+
+	r.writer.AddFrame(r.pixels, r.duration)
+
+	r.frames--
+	if r.frames == 0 {
+		r.save()
+	}
+}
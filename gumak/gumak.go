@@ -1,11 +1,12 @@
 package gumak
 
 import (
-	"embed"
-	_ "embed"
+	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"strings"
 
 	"mutex/gumak/device"
 	"mutex/gumak/formats"
@@ -13,9 +14,6 @@ import (
 	"mutex/gumak/z80"
 )
 
-//go:embed roms/*.rom
-var embedContent embed.FS
-
 type Key int
 
 const (
@@ -61,39 +59,28 @@ const (
 	KeyB
 )
 
-type config struct {
-	frequency       int
-	tStatesPerFrame int
-	roms            []string
-	paging          bool
-}
-
-var machines = map[string]config{
-	"48": {
-		frequency:       3500000,
-		tStatesPerFrame: 224 * 312,
-		roms:            []string{"48.rom"},
-		paging:          false,
-	},
-	"128": {
-		frequency:       3546900,
-		tStatesPerFrame: 228 * 311,
-		roms:            []string{"128-0.rom", "128-1.rom"},
-		paging:          true,
-	},
-}
-
 type Gumak struct {
-	Model string
+	Model   string
+	Machine Machine
 
 	Cpu       *z80.CPU
 	Ram       *device.Ram
 	Ula       *device.Ula
 	Beeper    *device.Beeper
 	Ay_3_8912 *device.AY_3_8912
+	Kempston  *device.Kempston
+	Io        *device.IoBus
+	Mixer     *device.Mixer
 
-	roms    []string
-	romPath string
+	// EAR signal of the playing tape, mixed as MIXER_TAPE.
+	TapeEar *device.Beeper
+
+	// Tape loads at full speed and silently, otherwise in real time with
+	// the loading sounds.
+	FastTape bool
+
+	romDir       fs.FS          // Host directory searched before embedded ROMs.
+	romOverrides map[int][]byte // Custom ROM images by slot.
 
 	sampleCounter float64 //
 	sampleTime    float64 // Time of single audio frame in seconds.
@@ -101,23 +88,42 @@ type Gumak struct {
 	tStatesFrame   int
 	tStatesSeconds float64
 
+	// T-states of the bus accesses and contention delay of the currently
+	// executed instruction.
+	busTStates int
+	contention int
+
 	tapeLoading  bool
 	tapeFinished chan bool
 
 	lowPass device.Lowpass
+
+	audioFreq int
+	recorder  *recorder
+	gif       *gifRecorder
+	ayLog     *ayLogger
+	wav       *wavExporter
 }
 
 // Main
 
-func CreateNew(is48K bool, audioFreq int) (*Gumak, error) {
+// CreateNew creates one of the registered machines (see Machines).
+func CreateNew(model string, audioFreq int) (*Gumak, error) {
+	machine, ok := FindMachine(model)
+	if !ok {
+		return nil, fmt.Errorf("Unknown machine: %s", model)
+	}
+
+	return CreateMachine(machine, audioFreq)
+}
+
+// CreateMachine creates emulator of custom machine definition.
+func CreateMachine(machine Machine, audioFreq int) (*Gumak, error) {
 	log.SetLevel(log.LevelDebug)
 	log.Info("=== Gumak started ===")
 
-	machineSettings := machines["128"]
-	machine := "128"
-	if is48K {
-		machineSettings = machines["48"]
-		machine = "48"
+	if err := machine.Validate(); err != nil {
+		return nil, err
 	}
 
 	log.TraceEnable(0)
@@ -125,18 +131,29 @@ func CreateNew(is48K bool, audioFreq int) (*Gumak, error) {
 
 	// HW
 	cpu := new(z80.CPU)
-	cpu.Init(machineSettings.frequency, machineSettings.tStatesPerFrame, nil)
+	cpu.Init(machine.Frequency, machine.Timing.TStatesPerFrame(), nil)
 
 	ram := new(device.Ram)
+	ram.SetContendedBanks(machine.ContendedBanks)
+	if machine.Memory == 16 {
+		ram.SetPagePopulated(2, false)
+		ram.SetPagePopulated(3, false)
+	}
 	ram.Init()
 
 	beeper := new(device.Beeper)
-	beeper.Init(0.25)
+	beeper.Init()
 
 	ay_3_8192 := new(device.AY_3_8912)
+	ay_3_8192.Init(float64(machine.Frequency) / 2)
 
 	ula := new(device.Ula)
-	ula.Init(ram, beeper, ay_3_8192, machineSettings.paging)
+	if err := ula.Init(ram, beeper, machine.Paging, machine.Timing); err != nil {
+		return nil, err
+	}
+
+	io := new(device.IoBus)
+	ula.Attach(io)
 
 	gumak := new(Gumak)
 	gumak.Cpu = cpu
@@ -144,34 +161,83 @@ func CreateNew(is48K bool, audioFreq int) (*Gumak, error) {
 	gumak.Ula = ula
 	gumak.Beeper = beeper
 	gumak.Ay_3_8912 = ay_3_8192
-	gumak.Model = machine
-	gumak.roms = machineSettings.roms
-	gumak.romPath = "roms"
-	gumak.sampleTime = 1 / float64(audioFreq)
-
-	gumak.lowPass.Init(100, gumak.sampleTime)
+	gumak.Kempston = new(device.Kempston)
+	gumak.Mixer = new(device.Mixer)
+	gumak.Mixer.Init()
+	gumak.TapeEar = new(device.Beeper)
+	gumak.TapeEar.Init()
+	gumak.FastTape = true
+	gumak.Io = io
+	gumak.Model = machine.Name
+	gumak.Machine = machine
+	gumak.romOverrides = make(map[int][]byte)
+	if err := gumak.SetAudioFrequency(audioFreq); err != nil {
+		return nil, err
+	}
 
-	// Memory + IO bus.
+	// Memory + IO bus. The accesses follow each other by the length of
+	// their M-cycle: opcode fetch (M1) 4 T-states, memory read or write 3,
+	// I/O 4. Contention is applied at the start of the cycle, the refresh of
+	// M1 follows the fetch in its third T-state.
 	cpu.Pin.Bus = func() {
 		switch {
 		case cpu.Pin.MREQ: // Memory request
+			if ram.Contended(cpu.Pin.ADDR) {
+				gumak.contention += gumak.Machine.Timing.Contention(gumak.busTState())
+			}
+			if cpu.Pin.M1 && ram.Contended(uint16(cpu.Reg.I)<<8) {
+				ula.Snow(gumak.busTState()+2, cpu.Reg.R_())
+			}
 			if cpu.Pin.RD {
 				cpu.Pin.DATA = ram.Read(cpu.Pin.ADDR)
 			} else if cpu.Pin.WR {
+				ula.Update(gumak.busTState())
 				ram.Write(cpu.Pin.ADDR, cpu.Pin.DATA)
 			}
+			if cpu.Pin.M1 {
+				gumak.busTStates += 4
+			} else {
+				gumak.busTStates += 3
+			}
 		case cpu.Pin.IOREQ: // I/O request
+			gumak.contention += gumak.Machine.Timing.IoContention(cpu.Pin.ADDR, gumak.busTState(), ram.Contended(cpu.Pin.ADDR))
 			if cpu.Pin.RD {
-				cpu.Pin.DATA = ula.Read(cpu.Pin.ADDR)
+				cpu.Pin.DATA = io.Read(cpu.Pin.ADDR)
 			} else {
-				ula.Write(cpu.Pin.ADDR, cpu.Pin.DATA)
+				ula.Update(gumak.busTState())
+				io.Write(cpu.Pin.ADDR, cpu.Pin.DATA)
 			}
+			gumak.busTStates += 4
 		}
 	}
+	ula.FrameTState = gumak.busTState
+	ay_3_8192.Elapsed = gumak.sampleElapsed
+	beeper.Elapsed = gumak.sampleElapsed
+	gumak.TapeEar.Elapsed = gumak.sampleElapsed
+	ram.FloatingBus = ula.FloatingBus
+
+	for _, attach := range machine.Peripherals {
+		attach(gumak)
+	}
 
 	gumak.tStatesSeconds = cpu.TStateUs / 1e6
 	gumak.tapeFinished = make(chan bool, 16)
 
+	// ROMs are loaded by the reset.
+	if err := gumak.setRomDirectory(machine.RomDir); err != nil {
+		return nil, err
+	}
+	for _, image := range machine.RomImages {
+		if err := gumak.LoadRomReader(image.Slot, bytes.NewReader(image.Data), image.Checksum); err != nil {
+			return nil, fmt.Errorf("Failed to load ROM of slot %d: %w", image.Slot, err)
+		}
+	}
+
+	if missing := gumak.missingRoms(); len(missing) > 0 {
+		return nil, fmt.Errorf("Machine %s needs ROMs %s, copy them into gumak/roms or set ROM directory (-romdir, Machine.RomDir)",
+			machine.Name, strings.Join(missing, ", "))
+	}
+
 	// Run
 	err := gumak.Reset()
 	if err != nil {
@@ -184,15 +250,32 @@ func CreateNew(is48K bool, audioFreq int) (*Gumak, error) {
 func (g *Gumak) Reset() error {
 	g.Cpu.Restart()
 	g.Ram.Init()
+	g.Ula.Reset()
 
 	g.tStatesFrame = 0
 	g.sampleCounter = 0
 
 	g.Beeper.Reset()
+	g.TapeEar.Reset()
+	g.Ay_3_8912.Reset()
 
-	for i, rom := range g.roms {
-		_, err := g.Ram.LoadRom(embedContent, fmt.Sprintf("%s/%s", g.romPath, rom), i, 0x4000)
-		if err != nil {
+	for i, rom := range g.Machine.Roms {
+		if _, custom := g.romOverrides[i]; custom {
+			continue
+		}
+		if err := g.loadRom(i, rom, g.Machine.romChecksum(i)); err != nil {
+			return fmt.Errorf("Failed to load ROM '%s' of machine %s: %w", rom, g.Model, err)
+		}
+	}
+
+	if _, custom := g.romOverrides[device.ROM_TRDOS]; len(g.Machine.TrdosRom) > 0 && !custom {
+		if err := g.loadRom(device.ROM_TRDOS, g.Machine.TrdosRom, 0); err != nil {
+			log.Warning("TR-DOS ROM '%s' not available: %s", g.Machine.TrdosRom, err)
+		}
+	}
+
+	for slot, data := range g.romOverrides {
+		if err := g.Ram.LoadRomReader(bytes.NewReader(data), slot, 0); err != nil {
 			return err
 		}
 	}
@@ -201,7 +284,9 @@ func (g *Gumak) Reset() error {
 }
 
 func (g *Gumak) Tick() bool {
-	if g.Ula.Tape.Running && !g.tapeLoading {
+	// Fast loading runs the CPU with the tape on its own until the tape
+	// ends, the tape is not heard.
+	if g.Ula.Tape.Running && g.FastTape && !g.tapeLoading {
 		g.tapeLoading = true
 
 		go func() {
@@ -225,63 +310,161 @@ func (g *Gumak) Tick() bool {
 	}
 
 	if g.tStatesFrame < g.Cpu.TStatesPerFrame {
-		t := g.Cpu.Tick()
+		g.Cpu.Pin.INT = g.tStatesFrame < g.Machine.Timing.InterruptLength && !g.Ula.Timex.InterruptDisabled()
+
+		g.busTStates, g.contention = 0, 0
+		t := g.Cpu.Tick() + g.contention
+
+		// Real time loading.
+		if g.Ula.Tape.Running {
+			g.Ula.Tape.Update(t)
+			g.TapeEar.Beep(g.Ula.Tape.EarBit())
+		}
 
 		g.tStatesFrame += t
 		g.sampleCounter += float64(t) * g.tStatesSeconds
-
-		g.Cpu.Pin.INT = false
 	}
 
 	if g.tStatesFrame >= g.Cpu.TStatesPerFrame {
 		g.Ula.UpdateEndFrame()
+		if g.recorder != nil {
+			g.recorder.addFrame(g.Ula.Frame)
+		}
+		if g.gif != nil {
+			g.gif.addFrame(g.Ula.Frame)
+		}
+		if g.ayLog != nil {
+			g.ayLog.frame(g)
+		}
 		g.tStatesFrame -= g.Cpu.TStatesPerFrame
-		g.Cpu.Pin.INT = true
 		return true
 	}
 
 	return false
 }
 
+// WaitTapeLoaded blocks until fast loading of the tape started by Tick
+// finishes, returns false when no tape is loading. Tick returns true without
+// emulating a frame during the loading, headless hosts wait instead of
+// counting such frames.
+func (g *Gumak) WaitTapeLoaded() bool {
+	if !g.tapeLoading {
+		return false
+	}
+
+	<-g.tapeFinished
+	g.tapeLoading = false
+	return true
+}
+
+// Approximate T-state of the current bus access within the frame.
+func (g *Gumak) busTState() int {
+	return g.tStatesFrame + g.busTStates + g.contention
+}
+
+// Time of the current bus access since the last audio sample in seconds.
+func (g *Gumak) sampleElapsed() float64 {
+	return g.sampleCounter + float64(g.busTStates+g.contention)*g.tStatesSeconds
+}
+
+// Number of interrupts (frames) per second.
+func (g *Gumak) FrameRate() float64 {
+	return float64(g.Cpu.Frequency) / float64(g.Cpu.TStatesPerFrame)
+}
+
 // Graphics
 
 func InnerResolution() (width int, height int) {
 	return device.DisplayRes.W, device.DisplayRes.H
 }
 
+// OuterResolution is the default resolution of the frame including the
+// border.
 func OuterResolution() (width int, height int) {
 	return device.ScreenRes.W, device.ScreenRes.H
 }
 
-func (g *Gumak) CopyVRam(output []byte) {
-	// TODO: Improve.
-	// Since we are syncing by audio we need to make copy of a VRAM
-	// exactly when frame should be rendered (not later).
-	v := g.Ram.Bank(g.Ula.VRamBank)
+// FrameResolution returns resolution of the last frame, width is doubled in
+// Timex hi-res mode.
+func (g *Gumak) FrameResolution() (width int, height int) {
+	return g.Ula.Frame.Res.W, g.Ula.Frame.Res.H
+}
 
-	for i := range output {
-		output[i] = v[i]
-	}
+// SetFrameResolution changes size of the border around the display area,
+// the display is centered. Border has to be multiple of 8 pixels wide and
+// has to fit into the frame of the machine.
+func (g *Gumak) SetFrameResolution(width, height int) error {
+	return g.Ula.SetScreenRes(device.Resolution{W: width, H: height})
+}
+
+// NewFrame creates frame buffer for CopyFrame.
+func (g *Gumak) NewFrame() *device.Screen {
+	return device.NewScreen(g.Ula.Frame.Res)
+}
+
+// CopyFrame copies the last finished frame including the border (colour
+// indexes, see device.Screen), it has to be called at the end of the frame
+// (when Tick returns true) since we are syncing by audio.
+func (g *Gumak) CopyFrame(output *device.Screen) {
+	g.Ula.Frame.CopyTo(output)
 }
 
-func (g *Gumak) GetDisplayDataRGB(data, vram []byte, pitch int) {
-	device.FillDisplay(data, pitch, g.Ula.Frames >= 16, vram, 0, 1, 2, 3)
+// GetFrame converts the last finished frame into the pixel format.
+func (g *Gumak) GetFrame(data []byte, pitch int, format device.PixelFormat) {
+	device.ConvertFrame(data, pitch, format, g.Ula.Frame)
 }
 
-func (g *Gumak) GetDisplayDataBGR(data, vram []byte, pitch int) {
-	device.FillDisplay(data, pitch, g.Ula.Frames >= 16, vram, 2, 1, 0, 3)
+// Converts frame copied by CopyFrame.
+func (g *Gumak) GetDisplayDataRGB(data []byte, frame *device.Screen, pitch int) {
+	device.ConvertFrame(data, pitch, device.PIXEL_FORMAT_RGBA, frame)
 }
 
-func (g *Gumak) GetDisplayDataRGBVram(data []byte, pitch int) {
-	device.FillDisplay(data, pitch, g.Ula.Frames >= 16, g.Ram.Bank(g.Ula.VRamBank), 0, 1, 2, 3)
+func (g *Gumak) GetDisplayDataBGR(data []byte, frame *device.Screen, pitch int) {
+	device.ConvertFrame(data, pitch, device.PIXEL_FORMAT_BGRA, frame)
 }
 
-func (g *Gumak) GetDisplayDataBGRVram(data []byte, pitch int) {
-	device.FillDisplay(data, pitch, g.Ula.Frames >= 16, g.Ram.Bank(g.Ula.VRamBank), 2, 1, 0, 3)
+// Renders the last finished frame.
+func (g *Gumak) GetDisplayDataRGBFrame(data []byte, pitch int) {
+	g.GetFrame(data, pitch, device.PIXEL_FORMAT_RGBA)
+}
+
+func (g *Gumak) GetDisplayDataBGRFrame(data []byte, pitch int) {
+	g.GetFrame(data, pitch, device.PIXEL_FORMAT_BGRA)
+}
+
+// Palettes returns names of the palette presets.
+func Palettes() []string {
+	names := make([]string, len(device.Palettes))
+	for i, p := range device.Palettes {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// SetPalette selects palette preset (see Palettes) of the rendered frames.
+func (g *Gumak) SetPalette(name string) error {
+	palette, ok := device.FindPalette(name)
+	if !ok {
+		return fmt.Errorf("Unknown palette: %s", name)
+	}
+
+	g.Ula.Palette = palette
+	return nil
+}
+
+// LoadPalette sets user palette from text file (see device.ParsePalette).
+func (g *Gumak) LoadPalette(file string) error {
+	palette, err := device.LoadPalette(file)
+	if err != nil {
+		return fmt.Errorf("Failed to load palette '%s': %w", file, err)
+	}
+
+	g.Ula.Palette = palette
+	return nil
 }
 
 func (gum *Gumak) GetBackgroundColor() (r uint8, g uint8, b uint8) {
-	color := device.Colors[gum.Ula.BorderColor]
+	color := gum.Ula.Palette[gum.Ula.BorderColor]
 	return color.R, color.G, color.B
 }
 
@@ -298,6 +481,22 @@ func (g *Gumak) HandleKey(key Key, down bool) {
 	}
 }
 
+type JoystickButton uint8
+
+const (
+	JoystickRight = JoystickButton(device.KEMPSTON_RIGHT)
+	JoystickLeft  = JoystickButton(device.KEMPSTON_LEFT)
+	JoystickDown  = JoystickButton(device.KEMPSTON_DOWN)
+	JoystickUp    = JoystickButton(device.KEMPSTON_UP)
+	JoystickFire  = JoystickButton(device.KEMPSTON_FIRE)
+)
+
+// HandleJoystick updates the Kempston joystick, it is visible to the machine
+// only when PeripheralKempston is attached.
+func (g *Gumak) HandleJoystick(button JoystickButton, down bool) {
+	g.Kempston.Press(uint8(button), down)
+}
+
 // I/O
 
 func (g *Gumak) PlayTape(file string) error {
@@ -347,17 +546,159 @@ func (g *Gumak) SaveSnapshot(filename string, writer io.Writer) error {
 	return snapshot.Save(writer, g.Cpu, g.Ula, g.Ram)
 }
 
+// LoadScreen loads .scr file into the displayed VRAM bank (shadow screen
+// on 128K when paged in).
+func (g *Gumak) LoadScreen(filename string, reader io.Reader) error {
+	if reader == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	return formats.LoadScr(reader, g.Ula, g.Ram)
+}
+
+// SaveScreen saves the displayed VRAM bank as .scr file.
+func (g *Gumak) SaveScreen(filename string, writer io.Writer) error {
+	if writer == nil {
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		writer = f
+	}
+
+	return formats.SaveScr(writer, g.Ula, g.Ram)
+}
+
+// SaveScreenshot saves the last finished frame including the border as PNG.
+func (g *Gumak) SaveScreenshot(filename string, writer io.Writer) error {
+	if writer == nil {
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		writer = f
+	}
+
+	return formats.SavePng(writer, g.Ula.Frame)
+}
+
 // Audio
+//
+// Audio is synthesized directly at the output rate, the AY and the beeper
+// are averaged over each output sample, so any host rate can be used.
+// Samples are stereo frames, either popped one by one or read in blocks of
+// interleaved float32 or int16 frames.
+
+const (
+	AUDIO_FREQ_MIN = 8000
+	AUDIO_FREQ_MAX = 192000
+)
+
+// SetAudioFrequency changes the output sample rate.
+func (g *Gumak) SetAudioFrequency(freq int) error {
+	if freq < AUDIO_FREQ_MIN || freq > AUDIO_FREQ_MAX {
+		return fmt.Errorf("Invalid audio frequency %d Hz", freq)
+	}
+
+	if g.recorder != nil || g.wav != nil {
+		return fmt.Errorf("Audio frequency cannot change while recording")
+	}
+
+	g.audioFreq = freq
+	g.sampleTime = 1 / float64(freq)
+	g.lowPass.Init(100, g.sampleTime)
+	return nil
+}
+
+func (g *Gumak) AudioFrequency() int {
+	return g.audioFreq
+}
+
 func (g *Gumak) AudioSampleReady() bool {
 	return g.sampleCounter >= g.sampleTime
 }
 
+// PopAudioSample returns mono sample, average of the stereo channels.
 func (g *Gumak) PopAudioSample() uint8 {
+	left, right := g.PopAudioFloat()
+	return uint8(128 + 127*(left+right)/2)
+}
+
+// PopAudioStereo returns left and right unsigned 8-bit sample.
+func (g *Gumak) PopAudioStereo() (left, right uint8) {
+	l, r := g.PopAudioFloat()
+	return uint8(128 + 127*l), uint8(128 + 127*r)
+}
+
+// PopAudioFloat returns left and right sample of the mixer output, -1..1.
+func (g *Gumak) PopAudioFloat() (left, right float32) {
 	g.sampleCounter -= g.sampleTime
 
-	beep := g.Beeper.Sample()
-	sound := g.Ay_3_8912.Sample(g.sampleTime)
+	var sources [device.MIXER_SOURCES]float64
+	sources[device.MIXER_BEEPER] = g.Beeper.Sample(g.sampleTime)
+	ay := g.Ay_3_8912.Sample(g.sampleTime)
+	copy(sources[device.MIXER_AY_A:], ay[:])
+	sources[device.MIXER_TAPE] = g.TapeEar.Sample(g.sampleTime)
 
-	mix := 0.5*beep + 0.5*sound
-	return uint8(128 + 128*mix)
+	l, r := g.Mixer.Mix(sources)
+	left, right = float32(l), float32(r)
+
+	if g.recorder != nil {
+		g.recorder.addSample(left, right)
+	}
+	if g.wav != nil {
+		g.wav.addSample(left, right)
+	}
+
+	return left, right
+}
+
+// Runs the emulation until the next audio sample, frameReady (optional) is
+// called at the end of each frame. Returns false without the sample while
+// the tape is fast loading, the loading is not heard.
+func (g *Gumak) runSample(frameReady func()) bool {
+	for !g.AudioSampleReady() {
+		frame := g.Tick()
+		if g.tapeLoading {
+			return false
+		}
+		if frame && frameReady != nil {
+			frameReady()
+		}
+	}
+
+	return true
+}
+
+// ReadAudio fills buffer with interleaved stereo frames, the emulation runs
+// as long as needed. frameReady (optional) is called at the end of each
+// emulated frame. The buffer gets silence during fast tape loading.
+func (g *Gumak) ReadAudio(buffer []float32, frameReady func()) {
+	for i := 0; i+1 < len(buffer); i += 2 {
+		if g.runSample(frameReady) {
+			buffer[i], buffer[i+1] = g.PopAudioFloat()
+		} else {
+			buffer[i], buffer[i+1] = 0, 0
+		}
+	}
+}
+
+// ReadAudioInt16 fills buffer with interleaved stereo 16-bit frames, see
+// ReadAudio.
+func (g *Gumak) ReadAudioInt16(buffer []int16, frameReady func()) {
+	for i := 0; i+1 < len(buffer); i += 2 {
+		if g.runSample(frameReady) {
+			left, right := g.PopAudioFloat()
+			buffer[i], buffer[i+1] = device.SampleInt16(left), device.SampleInt16(right)
+		} else {
+			buffer[i], buffer[i+1] = 0, 0
+		}
+	}
 }
@@ -0,0 +1,243 @@
+package gumak
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"mutex/gumak/device"
+)
+
+// Peripheral attaches additional device to the machine when it is created.
+type Peripheral func(g *Gumak)
+
+// Machine describes emulated model, new clones can be added by
+// RegisterMachine or created directly by CreateMachine. The memory map is
+// the one of the Spectrum (ROM at 0x0000, banks 5, 2 and 0), clones differ
+// in memory size, paging ports, contention and frame timing.
+type Machine struct {
+	Name        string
+	Description string
+
+	Frequency int // CPU clock in Hz.
+	Memory    int // RAM size in KB, 16K model has 0x8000-0xffff unpopulated.
+
+	Roms         []string // ROM images, loaded into ROM slots 0..3.
+	RomChecksums []uint32 // Optional CRC-32 of Roms, 0 is not verified.
+	TrdosRom     string   // Optional, loaded into device.ROM_TRDOS slot.
+
+	// Optional host directory with the ROM images, searched before the
+	// embedded ROMs (see SetRomDirectory).
+	RomDir string
+	// Custom ROM images replacing the machine ROMs (see LoadRomReader).
+	RomImages []RomImage
+
+	Paging         device.Paging // Paging ports decoding and floating bus.
+	ContendedBanks uint8         // device.CONTENDED_BANKS_*.
+
+	// Frame geometry, interrupt and contention timing.
+	Timing device.Timing
+
+	Peripherals []Peripheral
+}
+
+// Custom 16K ROM image of the slot.
+type RomImage struct {
+	Slot     int
+	Data     []byte
+	Checksum uint32 // CRC-32, 0 is not verified.
+}
+
+// AY-3-8912 sound chip at ports 0xfffd and 0xbffd.
+func PeripheralAY(g *Gumak) {
+	g.Ay_3_8912.Attach(g.Io)
+}
+
+// Kempston joystick interface at port 0x1f.
+func PeripheralKempston(g *Gumak) {
+	g.Kempston.Attach(g.Io)
+}
+
+// ULAplus 64 colour palette at ports 0xbf3b and 0xff3b.
+func PeripheralUlaPlus(g *Gumak) {
+	g.Ula.UlaPlus = new(device.UlaPlus)
+	g.Ula.UlaPlus.Attach(g.Io)
+}
+
+// Timex screen modes (second screen, hi-colour, hi-res) at port 0xff.
+func PeripheralTimex(g *Gumak) {
+	g.Ula.Timex = new(device.Timex)
+	g.Ula.Timex.Attach(g.Io)
+}
+
+var plus3 = Machine{
+	Frequency:      3546900,
+	Memory:         128,
+	Roms:           []string{"plus3-0.rom", "plus3-1.rom", "plus3-2.rom", "plus3-3.rom"},
+	Paging:         device.PagingPlus3,
+	ContendedBanks: device.CONTENDED_BANKS_PLUS3,
+	Timing:         device.TimingPlus3,
+	Peripherals:    []Peripheral{PeripheralAY},
+}
+
+func withName(m Machine, name, description string) Machine {
+	m.Name = name
+	m.Description = description
+	return m
+}
+
+var machines = []Machine{
+	{
+		Name:           "16",
+		Description:    "ZX Spectrum 16K",
+		Frequency:      3500000,
+		Memory:         16,
+		Roms:           []string{"48.rom"},
+		Paging:         device.PagingNone,
+		ContendedBanks: device.CONTENDED_BANKS_48K,
+		Timing:         device.Timing48K,
+	},
+	{
+		Name:           "48",
+		Description:    "ZX Spectrum 48K",
+		Frequency:      3500000,
+		Memory:         48,
+		Roms:           []string{"48.rom"},
+		Paging:         device.PagingNone,
+		ContendedBanks: device.CONTENDED_BANKS_48K,
+		Timing:         device.Timing48K,
+	},
+	{
+		Name:           "48ntsc",
+		Description:    "ZX Spectrum 48K (NTSC)",
+		Frequency:      3527500,
+		Memory:         48,
+		Roms:           []string{"48.rom"},
+		Paging:         device.PagingNone,
+		ContendedBanks: device.CONTENDED_BANKS_48K,
+		Timing:         device.Timing48KNtsc,
+	},
+	{
+		Name:           "128",
+		Description:    "ZX Spectrum 128K",
+		Frequency:      3546900,
+		Memory:         128,
+		Roms:           []string{"128-0.rom", "128-1.rom"},
+		Paging:         device.Paging128,
+		ContendedBanks: device.CONTENDED_BANKS_128K,
+		Timing:         device.Timing128K,
+		Peripherals:    []Peripheral{PeripheralAY},
+	},
+	withName(plus3, "+2A", "ZX Spectrum +2A"),
+	withName(plus3, "+3", "ZX Spectrum +3"),
+	{
+		Name:           "pentagon",
+		Description:    "Pentagon 128",
+		Frequency:      3500000,
+		Memory:         128,
+		Roms:           []string{"128-0.rom", "128-1.rom"},
+		TrdosRom:       "trdos.rom",
+		Paging:         device.PagingPentagon,
+		ContendedBanks: device.CONTENDED_BANKS_NONE,
+		Timing:         device.TimingPentagon,
+		Peripherals:    []Peripheral{PeripheralAY},
+	},
+}
+
+// Guards machines, registration can run concurrently with lookups.
+var machinesMutex sync.RWMutex
+
+// Machines returns all registered machines.
+func Machines() []Machine {
+	machinesMutex.RLock()
+	defer machinesMutex.RUnlock()
+
+	return append([]Machine(nil), machines...)
+}
+
+func FindMachine(name string) (Machine, bool) {
+	machinesMutex.RLock()
+	defer machinesMutex.RUnlock()
+
+	return findMachine(name)
+}
+
+func findMachine(name string) (Machine, bool) {
+	for _, m := range machines {
+		if m.Name == name {
+			return m, true
+		}
+	}
+
+	return Machine{}, false
+}
+
+// RegisterMachine adds new machine which can be then created by its name.
+func RegisterMachine(m Machine) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	machinesMutex.Lock()
+	defer machinesMutex.Unlock()
+
+	if _, exists := findMachine(m.Name); exists {
+		return fmt.Errorf("Machine '%s' already registered", m.Name)
+	}
+
+	machines = append(machines, m)
+	return nil
+}
+
+// UnregisterMachine removes machine by its name, reports whether it was
+// registered. Already created machines are not affected.
+func UnregisterMachine(name string) bool {
+	machinesMutex.Lock()
+	defer machinesMutex.Unlock()
+
+	for i, m := range machines {
+		if m.Name == name {
+			machines = append(machines[:i:i], machines[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Machine) Validate() error {
+	if len(m.Name) == 0 {
+		return errors.New("Machine has no name")
+	}
+
+	if m.Frequency <= 0 {
+		return fmt.Errorf("Machine '%s': invalid frequency", m.Name)
+	}
+
+	if m.Timing.TStatesPerLine <= 0 || m.Timing.ScanLines <= 0 {
+		return fmt.Errorf("Machine '%s': invalid frame geometry", m.Name)
+	}
+
+	if len(m.Roms) == 0 || len(m.Roms) > 4 {
+		return fmt.Errorf("Machine '%s': invalid number of ROMs", m.Name)
+	}
+
+	if len(m.RomChecksums) > len(m.Roms) {
+		return fmt.Errorf("Machine '%s': more ROM checksums than ROMs", m.Name)
+	}
+
+	if len(m.TrdosRom) > 0 && len(m.Roms) > device.ROM_TRDOS {
+		return fmt.Errorf("Machine '%s': TR-DOS ROM slot is used by machine ROMs", m.Name)
+	}
+
+	// Paging needs all 8 banks.
+	switch {
+	case m.Paging.Port1ffd.Present() && !m.Paging.Port7ffd.Present():
+		return fmt.Errorf("Machine '%s': port 0x1ffd without port 0x7ffd", m.Name)
+	case m.Paging.Port7ffd.Present() && m.Memory != 128,
+		!m.Paging.Port7ffd.Present() && m.Memory != 16 && m.Memory != 48:
+		return fmt.Errorf("Machine '%s': invalid memory size %dK", m.Name, m.Memory)
+	}
+
+	return nil
+}
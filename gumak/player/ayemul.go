@@ -0,0 +1,148 @@
+package player
+
+import (
+	"mutex/gumak/formats"
+	"mutex/gumak/helpers"
+	"mutex/gumak/z80"
+)
+
+// ZXAYEMUL environment of .ay files, 64K RAM with the song blocks and
+// a stub calling the init and interrupt routines of the player:
+//
+//	Address        Content
+//	0x0000-0x00ff  0xc9 (RET), the stub at 0x0000, 0xfb (EI) at 0x0038
+//	0x0100-0x3fff  0xff
+//	0x4000-0xffff  0x00, then the blocks
+//
+//	Interrupt routine      Stub
+//	0                      DI; CALL init; loop: IM 2; EI; HALT; JR loop
+//	given                  DI; CALL init; loop: IM 1; EI; HALT; CALL int; JR loop
+//
+// All registers are set to the song's hi/lo register value, I to 3. The
+// Z80 runs at 128K speed with an interrupt every frame, the AY is on the
+// 128K ports and the beeper on port 0xfe.
+
+const (
+	ayCpuFrequency     = 3546900
+	ayTStatesFrame     = 70908
+	ayInterruptTStates = 32
+)
+
+type ayEmul struct {
+	file *formats.AyFile
+
+	cpu     *z80.CPU
+	ram     [0x10000]uint8
+	tStates int // T-states of the current frame.
+}
+
+func (a *ayEmul) songs() int {
+	return len(a.file.Songs)
+}
+
+func (a *ayEmul) song(n int) (name string, frames, fade int) {
+	song := &a.file.Songs[n]
+	return song.Name, song.Length, song.Fade
+}
+
+func (a *ayEmul) timing() (clock, frameRate float64) {
+	return ayCpuFrequency / 2, float64(ayCpuFrequency) / ayTStatesFrame
+}
+
+func (a *ayEmul) start(p *Player, n int) {
+	song := &a.file.Songs[n]
+
+	for addr := range a.ram {
+		switch {
+		case addr < 0x0100:
+			a.ram[addr] = 0xc9
+		case addr < 0x4000:
+			a.ram[addr] = 0xff
+		default:
+			a.ram[addr] = 0
+		}
+	}
+	a.ram[0x38] = 0xfb
+
+	init := song.Init
+	if init == 0 && len(song.Blocks) > 0 {
+		init = song.Blocks[0].Address
+	}
+
+	initLo, initHi := helpers.To8(init)
+	stub := []uint8{0xf3, 0xcd, initLo, initHi}
+	if song.Interrupt == 0 {
+		stub = append(stub, 0xed, 0x5e, 0xfb, 0x76, 0x18, 0xfa)
+	} else {
+		intLo, intHi := helpers.To8(song.Interrupt)
+		stub = append(stub, 0xed, 0x56, 0xfb, 0x76, 0xcd, intLo, intHi, 0x18, 0xf7)
+	}
+	copy(a.ram[:], stub)
+
+	for _, block := range song.Blocks {
+		copy(a.ram[block.Address:], block.Data)
+	}
+
+	cpu := new(z80.CPU)
+	cpu.Init(ayCpuFrequency, ayTStatesFrame, nil)
+
+	r := &cpu.Reg
+	for _, reg := range []*uint8{&r.A, &r.B, &r.D, &r.H, &r.A_, &r.B_, &r.D_, &r.H_} {
+		*reg = song.HiReg
+	}
+	for _, reg := range []*uint8{&r.F, &r.C, &r.E, &r.L, &r.F_, &r.C_, &r.E_, &r.L_} {
+		*reg = song.LoReg
+	}
+	r.IX = helpers.To16(song.LoReg, song.HiReg)
+	r.IY = r.IX
+	r.I = 3
+	r.SP = song.Stack
+	r.PC = 0
+
+	cpu.Pin.Bus = func() {
+		switch {
+		case cpu.Pin.MREQ:
+			if cpu.Pin.RD {
+				cpu.Pin.DATA = a.ram[cpu.Pin.ADDR]
+			} else if cpu.Pin.WR {
+				a.ram[cpu.Pin.ADDR] = cpu.Pin.DATA
+			}
+		case cpu.Pin.IOREQ:
+			a.io(p, cpu.Pin.ADDR, cpu.Pin.RD)
+		}
+	}
+
+	a.cpu = cpu
+	a.tStates = 0
+}
+
+// Same decoding as on 128K, AY at 0xfffd/0xbffd and beeper on even ports.
+func (a *ayEmul) io(p *Player, addr uint16, read bool) {
+	cpu := a.cpu
+
+	switch {
+	case read && addr&0xc002 == 0xc000:
+		cpu.Pin.DATA = p.Ay.Read()
+	case read:
+		cpu.Pin.DATA = 0xff
+	case addr&0xc002 == 0xc000:
+		p.Ay.SelectRegister(cpu.Pin.DATA)
+	case addr&0xc002 == 0x8000:
+		p.Ay.Write(cpu.Pin.DATA)
+	case addr&0x0001 == 0:
+		p.Beeper.Beep(cpu.Pin.DATA&0b10000 != 0)
+	}
+}
+
+func (a *ayEmul) step(p *Player) float64 {
+	a.cpu.Pin.INT = a.tStates < ayInterruptTStates
+	t := a.cpu.Tick()
+
+	a.tStates += t
+	if a.tStates >= ayTStatesFrame {
+		a.tStates -= ayTStatesFrame
+		p.endFrame()
+	}
+
+	return float64(t) / ayCpuFrequency
+}
@@ -0,0 +1,243 @@
+// Package player plays AY music files without the emulated machine. The
+// register dumps (.psg, .ym) are written to the AY frame by frame, the
+// .ay files run their player code on a Z80 in minimal environment.
+package player
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mutex/gumak/device"
+	"mutex/gumak/formats"
+)
+
+const (
+	AUDIO_FREQ_MIN = 8000
+	AUDIO_FREQ_MAX = 192000
+
+	// Songs of unknown length are played this long.
+	DEFAULT_SECONDS = 180
+)
+
+// Source of the AY register writes.
+type source interface {
+	songs() int
+	song(n int) (name string, frames, fade int)
+	start(p *Player, n int)
+
+	// AY clock in Hz and frames (interrupts) per second.
+	timing() (clock, frameRate float64)
+
+	// Runs the source by one step (instruction or frame) with the
+	// register writes at the current time, returns its duration in seconds.
+	step(p *Player) float64
+}
+
+type Player struct {
+	Title  string
+	Author string
+
+	Ay     *device.AY_3_8912
+	Beeper *device.Beeper
+	Mixer  *device.Mixer
+
+	source source
+	song   int
+	frames int // Frames of the song, 0 unknown.
+	fade   int // Fade out frames at the end of the song.
+	frame  int // Frames played.
+
+	frameRate  float64
+	frameReady func()
+
+	sampleCounter float64 // Time emulated since the last sample.
+	sampleTime    float64 // Time of single audio frame in seconds.
+	audioFreq     int
+}
+
+// Open loads music file, see Load.
+func Open(filename string, audioFreq int) (*Player, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(filename, f, audioFreq)
+}
+
+// Load loads music file by its extension (.ay, .psg, .ym) and starts its
+// first song.
+func Load(filename string, reader io.Reader, audioFreq int) (*Player, error) {
+	if audioFreq < AUDIO_FREQ_MIN || audioFreq > AUDIO_FREQ_MAX {
+		return nil, fmt.Errorf("Invalid audio frequency %d Hz", audioFreq)
+	}
+
+	p := &Player{
+		Ay:         new(device.AY_3_8912),
+		Beeper:     new(device.Beeper),
+		Mixer:      new(device.Mixer),
+		audioFreq:  audioFreq,
+		sampleTime: 1 / float64(audioFreq),
+	}
+	p.Beeper.Init()
+	p.Mixer.Init()
+	p.Ay.Elapsed = p.elapsed
+	p.Beeper.Elapsed = p.elapsed
+
+	first := 0
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ay":
+		ay, err := formats.LoadAy(reader)
+		if err != nil {
+			return nil, err
+		}
+		p.Author = ay.Author
+		p.source = &ayEmul{file: ay}
+		first = ay.FirstSong
+	case ".psg":
+		frames, err := formats.LoadPsg(reader)
+		if err != nil {
+			return nil, err
+		}
+		p.source = newPsgStream(frames)
+	case ".ym":
+		song, err := formats.LoadYm(reader)
+		if err != nil {
+			return nil, err
+		}
+		p.Title, p.Author = song.Name, song.Author
+		p.source = &ymStream{ym: song}
+	default:
+		return nil, fmt.Errorf("Unknown music file format: %s", filename)
+	}
+
+	if p.source.songs() == 0 {
+		return nil, fmt.Errorf("No songs in %s", filename)
+	}
+
+	p.SelectSong(first)
+	return p, nil
+}
+
+func (p *Player) Songs() int {
+	return p.source.songs()
+}
+
+func (p *Player) Song() int {
+	return p.song
+}
+
+// SongName returns name of the current song (title of the file when the
+// format has no song names).
+func (p *Player) SongName() string {
+	if name, _, _ := p.source.song(p.song); len(name) > 0 {
+		return name
+	}
+	return p.Title
+}
+
+// SelectSong restarts the player with song n (from 0).
+func (p *Player) SelectSong(n int) error {
+	if n < 0 || n >= p.source.songs() {
+		return fmt.Errorf("Invalid song %d, the file has %d", n+1, p.source.songs())
+	}
+
+	p.song = n
+	_, p.frames, p.fade = p.source.song(n)
+	p.frame = 0
+	p.sampleCounter = 0
+
+	clock, frameRate := p.source.timing()
+	p.frameRate = frameRate
+	p.Ay.Init(clock)
+	p.Beeper.Reset()
+	p.source.start(p, n)
+	return nil
+}
+
+// Length of the song in seconds, 0 unknown.
+func (p *Player) Length() float64 {
+	return float64(p.frames) / p.frameRate
+}
+
+// Seconds played.
+func (p *Player) Position() float64 {
+	return float64(p.frame) / p.frameRate
+}
+
+// Finished reports end of the song of known length.
+func (p *Player) Finished() bool {
+	return p.frames > 0 && p.frame >= p.frames
+}
+
+func (p *Player) AudioFrequency() int {
+	return p.audioFreq
+}
+
+// Time since the last audio sample, register writes take effect at it.
+func (p *Player) elapsed() float64 {
+	return p.sampleCounter
+}
+
+// Called by the sources at the end of each frame.
+func (p *Player) endFrame() {
+	p.frame++
+	if p.frameReady != nil {
+		p.frameReady()
+	}
+}
+
+// PopAudioFloat runs the player until the next sample and returns left and
+// right sample of the mixer output, -1..1.
+func (p *Player) PopAudioFloat() (left, right float32) {
+	for p.sampleCounter < p.sampleTime {
+		p.sampleCounter += p.source.step(p)
+	}
+	p.sampleCounter -= p.sampleTime
+
+	var sources [device.MIXER_SOURCES]float64
+	sources[device.MIXER_BEEPER] = p.Beeper.Sample(p.sampleTime)
+	ay := p.Ay.Sample(p.sampleTime)
+	copy(sources[device.MIXER_AY_A:], ay[:])
+
+	l, r := p.Mixer.Mix(sources)
+
+	// Fade out at the end of the song, silence after it.
+	if p.frames > 0 {
+		if rest := p.frames - p.frame; rest <= 0 {
+			l, r = 0, 0
+		} else if rest < p.fade {
+			gain := float64(rest) / float64(p.fade)
+			l, r = l*gain, r*gain
+		}
+	}
+
+	return float32(l), float32(r)
+}
+
+// ReadAudio fills buffer with interleaved stereo frames, frameReady
+// (optional) is called at the end of each frame of the song.
+func (p *Player) ReadAudio(buffer []float32, frameReady func()) {
+	p.frameReady = frameReady
+	defer func() { p.frameReady = nil }()
+
+	for i := 0; i+1 < len(buffer); i += 2 {
+		buffer[i], buffer[i+1] = p.PopAudioFloat()
+	}
+}
+
+// ReadAudioInt16 fills buffer with interleaved stereo 16-bit frames, see
+// ReadAudio.
+func (p *Player) ReadAudioInt16(buffer []int16, frameReady func()) {
+	p.frameReady = frameReady
+	defer func() { p.frameReady = nil }()
+
+	for i := 0; i+1 < len(buffer); i += 2 {
+		left, right := p.PopAudioFloat()
+		buffer[i], buffer[i+1] = device.SampleInt16(left), device.SampleInt16(right)
+	}
+}
@@ -0,0 +1,102 @@
+package player
+
+import (
+	"mutex/gumak/formats"
+)
+
+// Register dumps, all writes of a frame happen at its start.
+
+const (
+	// PSG has no timing, it is logged from 128K at 50 Hz.
+	psgClock     = 1773450
+	psgFrameRate = 50
+)
+
+type psgStream struct {
+	frames [][]formats.AyWrite
+	frame  int
+}
+
+type ymStream struct {
+	ym    *formats.YmSong
+	frame int
+}
+
+func newPsgStream(frames [][]formats.AyWrite) *psgStream {
+	return &psgStream{frames: frames}
+}
+
+func writeRegister(p *Player, reg, value uint8) {
+	p.Ay.SelectRegister(reg)
+	p.Ay.Write(value)
+}
+
+func (s *psgStream) songs() int {
+	return 1
+}
+
+func (s *psgStream) song(n int) (name string, frames, fade int) {
+	return "", len(s.frames), 0
+}
+
+func (s *psgStream) timing() (clock, frameRate float64) {
+	return psgClock, psgFrameRate
+}
+
+func (s *psgStream) start(p *Player, n int) {
+	s.frame = 0
+}
+
+func (s *psgStream) step(p *Player) float64 {
+	if s.frame < len(s.frames) {
+		for _, write := range s.frames[s.frame] {
+			if write.Reg < 14 {
+				writeRegister(p, write.Reg, write.Value)
+			}
+		}
+		s.frame++
+	}
+
+	p.endFrame()
+	return 1.0 / psgFrameRate
+}
+
+func (s *ymStream) songs() int {
+	return 1
+}
+
+func (s *ymStream) song(n int) (name string, frames, fade int) {
+	return s.ym.Name, len(s.ym.Frames), 0
+}
+
+func (s *ymStream) timing() (clock, frameRate float64) {
+	clock, frameRate = float64(s.ym.Clock), float64(s.ym.Rate)
+	if clock == 0 {
+		clock = psgClock
+	}
+	if frameRate == 0 {
+		frameRate = psgFrameRate
+	}
+	return clock, frameRate
+}
+
+func (s *ymStream) start(p *Player, n int) {
+	s.frame = 0
+}
+
+func (s *ymStream) step(p *Player) float64 {
+	if s.frame < len(s.ym.Frames) {
+		regs := s.ym.Frames[s.frame]
+		for reg := uint8(0); reg < 13; reg++ {
+			writeRegister(p, reg, regs[reg])
+		}
+		if regs[13] != formats.YM_ENVELOPE_NO_WRITE {
+			writeRegister(p, 13, regs[13])
+		}
+		s.frame++
+	}
+
+	_, frameRate := s.timing()
+	p.endFrame()
+	return 1 / frameRate
+}
@@ -0,0 +1,185 @@
+package gumak
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mutex/gumak/device"
+	"mutex/gumak/formats"
+	"mutex/gumak/log"
+)
+
+// Video recording of every emulated frame and the mixed audio. Frames are
+// captured in Tick and stereo samples in PopAudioFloat, so the recording follows
+// the emulated time regardless of the host frame rate.
+
+type videoWriter interface {
+	WriteFrame(rgba []byte, pitch int) error
+	WriteAudio(samples []byte) error
+	Close() error
+}
+
+type recorder struct {
+	writer videoWriter
+	files  []*os.File
+	width  int
+	height int
+	rgba   []byte // Frame converted to the recording resolution.
+	frame  []byte // Frame in its native resolution (hi-res).
+	audio  []byte // Samples since the last frame.
+	err    error
+}
+
+// Y4M video with audio in separate WAV file.
+type y4mWavWriter struct {
+	video *formats.Y4mWriter
+	audio *formats.WavWriter
+}
+
+func (w *y4mWavWriter) WriteFrame(rgba []byte, pitch int) error {
+	return w.video.WriteFrame(rgba, pitch)
+}
+
+func (w *y4mWavWriter) WriteAudio(samples []byte) error {
+	_, err := w.audio.Write(samples)
+	return err
+}
+
+func (w *y4mWavWriter) Close() error {
+	if err := w.video.Close(); err != nil {
+		return err
+	}
+
+	return w.audio.Close()
+}
+
+// StartRecording records video to file by its extension: '.avi' for
+// uncompressed AVI, '.y4m' for YUV4MPEG2 with audio in '.wav' file of the
+// same name. The recording has the current frame resolution.
+func (g *Gumak) StartRecording(filename string) error {
+	if g.recorder != nil {
+		return fmt.Errorf("Recording already running")
+	}
+
+	width, height := g.FrameResolution()
+	rateNum, rateDen := g.Cpu.Frequency, g.Cpu.TStatesPerFrame
+	audio := formats.NewWaveFormat(g.audioFreq, 2, 16)
+
+	r := &recorder{width: width, height: height, rgba: make([]byte, 4*width*height)}
+
+	video, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	r.files = append(r.files, video)
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".avi":
+		r.writer, err = formats.NewAviWriter(video, width, height, rateNum, rateDen, audio)
+
+	case ".y4m":
+		var wav *os.File
+		wav, err = os.Create(strings.TrimSuffix(filename, filepath.Ext(filename)) + ".wav")
+		if err != nil {
+			break
+		}
+		r.files = append(r.files, wav)
+
+		w := new(y4mWavWriter)
+		if w.video, err = formats.NewY4mWriter(video, width, height, rateNum, rateDen); err != nil {
+			break
+		}
+		w.audio, err = formats.NewWavWriter(wav, audio)
+		r.writer = w
+
+	default:
+		err = fmt.Errorf("Unknown video format: %s", filename)
+	}
+
+	if err != nil {
+		r.close()
+		return err
+	}
+
+	log.Info("Recording %s (%dx%d)", filename, width, height)
+	g.recorder = r
+	return nil
+}
+
+// StopRecording finishes the recording, returns first error that occurred
+// while recording.
+func (g *Gumak) StopRecording() error {
+	if g.recorder == nil {
+		return nil
+	}
+
+	r := g.recorder
+	g.recorder = nil
+
+	if r.err == nil {
+		r.err = r.writer.Close()
+	}
+
+	if err := r.close(); r.err == nil {
+		r.err = err
+	}
+
+	return r.err
+}
+
+func (g *Gumak) Recording() bool {
+	return g.recorder != nil
+}
+
+func (r *recorder) close() error {
+	var err error
+	for _, f := range r.files {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Samples are stored as 16-bit little endian.
+func (r *recorder) addSample(left, right float32) {
+	l, h := device.SampleInt16(left), device.SampleInt16(right)
+	r.audio = append(r.audio, uint8(l), uint8(l>>8), uint8(h), uint8(h>>8))
+}
+
+func (r *recorder) addFrame(frame *device.Screen) {
+	if r.err != nil {
+		return
+	}
+
+	if frame.Res.W == r.width && frame.Res.H == r.height {
+		device.ConvertFrame(r.rgba, 4*r.width, device.PIXEL_FORMAT_RGBA, frame)
+	} else {
+		// Hi-res frames are sampled down to the recording resolution.
+		if len(r.frame) != 4*frame.Res.W*frame.Res.H {
+			r.frame = make([]byte, 4*frame.Res.W*frame.Res.H)
+		}
+		device.ConvertFrame(r.frame, 4*frame.Res.W, device.PIXEL_FORMAT_RGBA, frame)
+
+		for y := 0; y < r.height; y++ {
+			src := r.frame[(y*frame.Res.H/r.height)*4*frame.Res.W:]
+			dst := r.rgba[y*4*r.width:]
+			for x := 0; x < r.width; x++ {
+				copy(dst[4*x:4*x+4], src[4*(x*frame.Res.W/r.width):])
+			}
+		}
+	}
+
+	r.err = r.writer.WriteFrame(r.rgba, 4*r.width)
+	if r.err == nil {
+		r.err = r.writer.WriteAudio(r.audio)
+	}
+	r.audio = r.audio[:0]
+
+	if r.err != nil {
+		log.Error("Recording failed: %s", r.err)
+	}
+}
@@ -0,0 +1,149 @@
+package gumak
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"mutex/gumak/device"
+)
+
+//go:embed roms/*.rom
+var embedContent embed.FS
+
+// Loads ROM image of the machine, host ROM directory takes precedence over
+// the embedded ROMs.
+func (g *Gumak) loadRom(slot int, name string, checksum uint32) error {
+	if g.romDir != nil {
+		err := g.Ram.LoadRom(g.romDir, name, slot, checksum)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return g.Ram.LoadRom(embedContent, path.Join("roms", name), slot, checksum)
+}
+
+// Returns machine ROMs found neither in the host ROM directory nor in the
+// embedded ROMs, slots with custom ROM are skipped.
+func (g *Gumak) missingRoms() []string {
+	var missing []string
+	for slot, name := range g.Machine.Roms {
+		if _, custom := g.romOverrides[slot]; custom {
+			continue
+		}
+		if g.romDir != nil {
+			if _, err := fs.Stat(g.romDir, name); err == nil {
+				continue
+			}
+		}
+		if _, err := fs.Stat(embedContent, path.Join("roms", name)); err != nil {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing
+}
+
+// SetRomDirectory sets host directory with ROM images of the machine, ROMs
+// not found there are loaded from the embedded ones. Empty dir restores the
+// embedded ROMs. Machine is reset.
+func (g *Gumak) SetRomDirectory(dir string) error {
+	if err := g.setRomDirectory(dir); err != nil {
+		return err
+	}
+
+	return g.Reset()
+}
+
+func (g *Gumak) setRomDirectory(dir string) error {
+	if len(dir) == 0 {
+		g.romDir = nil
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	g.romDir = os.DirFS(dir)
+	return nil
+}
+
+// RomSlots returns ROM slots used by the machine.
+func (m *Machine) RomSlots() []int {
+	slots := make([]int, 0, len(m.Roms)+1)
+	for i := range m.Roms {
+		slots = append(slots, i)
+	}
+	if len(m.TrdosRom) > 0 {
+		slots = append(slots, device.ROM_TRDOS)
+	}
+
+	return slots
+}
+
+func (m *Machine) romChecksum(slot int) uint32 {
+	if slot < len(m.RomChecksums) {
+		return m.RomChecksums[slot]
+	}
+
+	return 0
+}
+
+// LoadRomFile replaces ROM in the slot by image from host file, see
+// LoadRomReader.
+func (g *Gumak) LoadRomFile(slot int, file string, checksum uint32) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := g.LoadRomReader(slot, f, checksum); err != nil {
+		return fmt.Errorf("Failed to load ROM '%s': %w", file, err)
+	}
+
+	return nil
+}
+
+// LoadRomReader replaces ROM in the slot by custom 16K image (SE Basic,
+// diagnostic ROMs...), checksum (CRC-32) is verified when not 0. The image
+// is kept across resets, the machine itself is not reset.
+func (g *Gumak) LoadRomReader(slot int, reader io.Reader, checksum uint32) error {
+	valid := false
+	for _, s := range g.Machine.RomSlots() {
+		valid = valid || s == slot
+	}
+	if !valid {
+		return fmt.Errorf("Machine %s has no ROM slot %d", g.Model, slot)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, device.ROM_SIZE+1))
+	if err != nil {
+		return err
+	}
+
+	if err := g.Ram.LoadRomReader(bytes.NewReader(data), slot, checksum); err != nil {
+		return err
+	}
+
+	g.romOverrides[slot] = data
+	return nil
+}
+
+// ResetRoms drops all custom ROM images loaded by LoadRomReader, machine is
+// reset.
+func (g *Gumak) ResetRoms() error {
+	g.romOverrides = make(map[int][]byte)
+	return g.Reset()
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"mutex/gumak"
+	"testing"
+)
+
+func TestReadAudio(t *testing.T) {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	if g.SetAudioFrequency(1000) == nil {
+		t.Fatalf("Invalid audio frequency accepted")
+	}
+
+	for _, freq := range []int{48000, 96000} {
+		if err := g.SetAudioFrequency(freq); err != nil {
+			t.Fatalf("Failed to set audio frequency: %s", err)
+		}
+
+		// One second of stereo frames.
+		frames := 0
+		buffer := make([]float32, 2*freq)
+		g.ReadAudio(buffer, func() { frames++ })
+
+		if frames < 49 || frames > 51 {
+			t.Fatalf("%d Hz: expected 50 frames per second, got %d", freq, frames)
+		}
+
+		for _, sample := range buffer {
+			if sample < -1 || sample > 1 {
+				t.Fatalf("%d Hz: sample %f out of range", freq, sample)
+			}
+		}
+	}
+
+	frames := 0
+	g.ReadAudioInt16(make([]int16, 2*96000/10), func() { frames++ })
+	if frames < 4 || frames > 6 {
+		t.Fatalf("Expected 5 frames per 0.1 s, got %d", frames)
+	}
+}
@@ -5,263 +5,124 @@ import (
 	"testing"
 )
 
-func equals(a, b, eps float64) bool {
-	return a >= b-eps && a <= b+eps
-}
-
-func testShape(t *testing.T, name string, s int, results []uint8) {
+func testShape(t *testing.T, name string, s int, segments ...[]uint8) {
 	var e device.Envelope
 
-	e.SetFreq(6991) // ~1
-
+	e.SetPeriod(1)
 	e.SetShape(uint8(s))
 
-	val := e.Update(0)
-
-	// fmt.Printf("Shape: %d [%s]\n", s, name)
-	// fmt.Printf("%d,\n", val)
-
-	if results[0] != val {
-		t.Fatalf("Expected %d got %d", results[0], val)
-	}
-
-	for i, time := 0, 0.; i < 14; i, time = i+1, time+0.2 {
-		val = e.Update(0.2)
-		// fmt.Printf("%d,\n", val)
-
-		if results[i+1] != val {
-			t.Fatalf("Expected %d got %d", results[i+1], val)
+	// Levels at the start of each segment, levels then change by 1 per step.
+	for cycle, levels := range segments {
+		for step := 0; step < 32; step++ {
+			expected := levels[0]
+			if levels[1] > levels[0] {
+				expected += uint8(step)
+			} else if levels[1] < levels[0] {
+				expected -= uint8(step)
+			}
+
+			if val := e.Level(); val != expected {
+				t.Fatalf("Shape %d [%s], cycle %d step %d: expected %d got %d", s, name, cycle, step, expected, val)
+			}
+			e.Step()
 		}
 	}
-
-	// fmt.Println("-------------")
 }
 
 func TestEnvelope(t *testing.T) {
+	down, up := []uint8{31, 0}, []uint8{0, 31}
+	bottom, top := []uint8{0, 0}, []uint8{31, 31}
 
-	{
-		results := []uint8{
-			15,
-			12,
-			9,
-			6,
-			3,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-		}
-
-		testShape(t, `\______`, 0b0000, results)
-		testShape(t, `\______`, 0b0100, results)
-		testShape(t, `\______`, 0b1000, results)
-		testShape(t, `\______`, 0b1100, results)
+	for _, s := range []int{0b0000, 0b0001, 0b0010, 0b0011, 0b1001} {
+		testShape(t, `\______`, s, down, bottom, bottom, bottom)
 	}
 
-	{
-		results := []uint8{
-			0,
-			3,
-			6,
-			9,
-			12,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-		}
-
-		testShape(t, `/|_____`, 0b0010, results)
-		testShape(t, `/|_____`, 0b0110, results)
-		testShape(t, `/|_____`, 0b1010, results)
-		testShape(t, `/|_____`, 0b1110, results)
+	for _, s := range []int{0b0100, 0b0101, 0b0110, 0b0111, 0b1111} {
+		testShape(t, `/|_____`, s, up, bottom, bottom, bottom)
 	}
 
-	{
-		results := []uint8{
-			15,
-			12,
-			9,
-			6,
-			3,
-			15,
-			12,
-			9,
-			6,
-			3,
-			15,
-			12,
-			9,
-			6,
-			3,
-		}
+	testShape(t, `\|\|\|\|`, 0b1000, down, down, down, down)
+	testShape(t, `\/\/\/\/`, 0b1010, down, up, down, up, down)
+	testShape(t, `\|^^^^^^`, 0b1011, down, top, top, top)
+	testShape(t, `/|/|/|/|`, 0b1100, up, up, up, up)
+	testShape(t, `/^^^^^^^`, 0b1101, up, top, top, top)
+	testShape(t, `/\/\/\/\`, 0b1110, up, down, up, down, up)
+}
 
-		testShape(t, `|\|\|\|\`, 0b0001, results)
-	}
+func TestEnvelopePeriod(t *testing.T) {
+	var e device.Envelope
 
-	{
-		results := []uint8{
-			15,
-			12,
-			9,
-			6,
-			3,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-		}
+	e.SetPeriod(3)
+	e.SetShape(0b1100)
 
-		testShape(t, `\_______`, 0b1001, results)
+	for step := 0; step < 3*32; step++ {
+		if e.Level() != uint8(step/3) || e.AyLevel() != uint8(step/6) {
+			t.Fatalf("Step %d: invalid level %d", step, e.Level())
+		}
+		e.Step()
 	}
+}
 
-	{
-		results := []uint8{
-			15,
-			12,
-			9,
-			6,
-			3,
-			0,
-			3,
-			6,
-			9,
-			12,
-			15,
-			12,
-			9,
-			6,
-			3,
-		}
+func TestNoise(t *testing.T) {
+	var n device.Noise
 
-		testShape(t, `\/\/\/\/\/\`, 0b0101, results)
-	}
+	n.Reset()
+	n.SetPeriod(1)
 
-	{
-		results := []uint8{
-			15,
-			12,
-			9,
-			6,
-			3,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-		}
+	// Maximal length 17-bit LFSR, one shift per 2 steps.
+	ones := 0
+	for i := 0; i < (1<<device.AY_NOISE_BITS)-1; i++ {
+		n.Step()
+		n.Step()
+		ones += int(n.Output())
+	}
 
-		testShape(t, `\|^^^^^^^^^`, 0b1101, results)
+	if ones != 1<<(device.AY_NOISE_BITS-1) {
+		t.Fatalf("Expected %d ones in LFSR period, got %d", 1<<(device.AY_NOISE_BITS-1), ones)
 	}
+}
 
-	{
-		results := []uint8{
-			0,
-			3,
-			6,
-			9,
-			12,
-			0,
-			3,
-			6,
-			9,
-			12,
-			0,
-			3,
-			6,
-			9,
-			12,
-		}
+func TestTone(t *testing.T) {
+	var ay device.AY_3_8912
 
-		testShape(t, `/|/|/|/|/|`, 0b0011, results)
+	clock, rate := 1773450., 44100
+	ay.Init(clock)
+
+	write := func(reg, value uint8) {
+		ay.SelectRegister(reg)
+		ay.Write(value)
 	}
 
-	{
-		results := []uint8{
-			0,
-			3,
-			6,
-			9,
-			12,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-			1,
-		}
+	write(0, 100)      // Tone A period.
+	write(7, 0b111110) // Tone A only.
+	write(8, 15)       // Volume A.
 
-		testShape(t, `/^^^^^^`, 0b1011, results)
+	// Let the DC filter settle.
+	for i := 0; i < rate; i++ {
+		ay.Sample(1 / float64(rate))
 	}
 
-	{
-		results := []uint8{
-			0,
-			3,
-			6,
-			9,
-			12,
-			15,
-			12,
-			9,
-			6,
-			3,
-			0,
-			3,
-			6,
-			9,
-			12,
+	rising, last := 0, ay.Sample(1 / float64(rate))[0]
+	for i := 0; i < rate; i++ {
+		v := ay.Sample(1 / float64(rate))[0]
+		if last <= 0 && v > 0 {
+			rising++
 		}
+		last = v
+	}
 
-		testShape(t, `/\/\/\/\/\/`, 0b0111, results)
+	freq := clock / (16 * 100)
+	if float64(rising) < freq-2 || float64(rising) > freq+2 {
+		t.Fatalf("Expected tone %.1f Hz, got %d periods", freq, rising)
 	}
 
-	{
-		results := []uint8{
-			0,
-			3,
-			6,
-			9,
-			12,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-			0,
-		}
+	if ay.Read() != 15 {
+		t.Fatalf("Invalid register readback")
+	}
 
-		testShape(t, `/|_______`, 0b1111, results)
+	// Unused bits are not stored.
+	write(1, 0xff)
+	if ay.Read() != 0x0f {
+		t.Fatalf("Invalid tone register mask")
 	}
 }
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mutex/gumak"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func logAy(t *testing.T, file string, format gumak.AyLogFormat) []byte {
+	g, err := gumak.CreateNew("128", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	if err := g.StartAyLog(file, format, 6); err != nil {
+		t.Fatalf("Failed to start AY log: %s", err)
+	}
+
+	for frame := 0; g.AyLogging(); frame++ {
+		// Tone A period in the second frame, envelope shape in the third.
+		switch frame {
+		case 1:
+			g.Io.Write(0xfffd, 0)
+			g.Io.Write(0xbffd, 0x42)
+		case 2:
+			g.Io.Write(0xfffd, 13)
+			g.Io.Write(0xbffd, 0x0e)
+		}
+
+		for !g.Tick() {
+		}
+	}
+
+	if err := g.StopAyLog(); err != nil {
+		t.Fatalf("Failed to save AY log: %s", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAyLogPsg(t *testing.T) {
+	data := logAy(t, filepath.Join(t.TempDir(), "test.psg"), gumak.AyLogPsg)
+
+	if !bytes.HasPrefix(data, []byte("PSG\x1a")) {
+		t.Fatalf("Invalid PSG header")
+	}
+
+	// Initial registers 0-12 in the first frame (the ROM does not touch
+	// the AY), then the writes and 3 empty frames.
+	stream := data[16+13*2:]
+	expected := []byte{0xff, 0, 0x42, 0xff, 13, 0x0e, 0xff, 0xff, 0xff, 0xff, 0xfd}
+	if !bytes.Equal(stream, expected) {
+		t.Fatalf("Invalid PSG stream % x", stream)
+	}
+}
+
+func TestAyLogYm(t *testing.T) {
+	data := logAy(t, filepath.Join(t.TempDir(), "test.ym"), gumak.AyLogYm6)
+
+	if !bytes.HasPrefix(data, []byte("YM6!LeOnArD!")) || !bytes.HasSuffix(data, []byte("End!")) {
+		t.Fatalf("Invalid YM file")
+	}
+
+	frames := int(binary.BigEndian.Uint32(data[12:]))
+	if frames != 6 {
+		t.Fatalf("Expected 6 frames, got %d", frames)
+	}
+
+	// Interleaved registers at the end of the file.
+	regs := data[len(data)-4-16*frames : len(data)-4]
+	if !bytes.Equal(regs[0:6], []byte{0, 0x42, 0x42, 0x42, 0x42, 0x42}) {
+		t.Fatalf("Invalid register 0: % x", regs[0:6])
+	}
+	if !bytes.Equal(regs[13*6:14*6], []byte{0xff, 0xff, 0x0e, 0xff, 0xff, 0xff}) {
+		t.Fatalf("Invalid register 13: % x", regs[13*6:14*6])
+	}
+}
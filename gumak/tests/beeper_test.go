@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"mutex/gumak/device"
+	"testing"
+)
+
+func TestBeeperIntegration(t *testing.T) {
+	var b device.Beeper
+	b.Init()
+
+	const sample = 1 / 44100.
+	elapsed := 0.
+	b.Elapsed = func() float64 { return elapsed }
+
+	// DC filter removes 1/1024 of the running sum.
+	check := func(expected float64) {
+		t.Helper()
+		if v := b.Sample(sample); !equals(v, expected, 0.002) {
+			t.Fatalf("Expected %f got %f", expected, v)
+		}
+	}
+
+	// Edge at 30% of the sample.
+	elapsed = 0.3 * sample
+	b.Beep(true)
+	check(0.3*-0.5 + 0.7*0.5)
+
+	// Pulse of 10% of the sample.
+	elapsed = 0.5 * sample
+	b.Beep(false)
+	elapsed = 0.6 * sample
+	b.Beep(true)
+	check(0.5 - 0.1)
+
+	// Edge at 20% of the next sample, after the end of this one.
+	elapsed = 1.2 * sample
+	b.Beep(false)
+	check(0.5)
+	elapsed = 0
+	check(0.2*0.5 + 0.8*-0.5)
+}
+
+func equals(a, b, eps float64) bool {
+	return a >= b-eps && a <= b+eps
+}
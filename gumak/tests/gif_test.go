@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"image/color"
+	"image/gif"
+	"mutex/gumak"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGif(t *testing.T) {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "test.gif")
+	if err := g.StartGif(file, 1, false); err != nil {
+		t.Fatalf("Failed to start GIF: %s", err)
+	}
+
+	for g.GifRecording() {
+		g.Tick()
+	}
+
+	if err := g.StopGif(); err != nil {
+		t.Fatalf("Failed to save GIF: %s", err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatalf("Invalid GIF: %s", err)
+	}
+
+	if anim.Config.Width != 256 || anim.Config.Height != 192 {
+		t.Fatalf("Invalid GIF size %dx%d", anim.Config.Width, anim.Config.Height)
+	}
+
+	// 15 colours and transparency.
+	if palette, ok := anim.Config.ColorModel.(color.Palette); !ok || len(palette) != 16 {
+		t.Fatalf("Invalid GIF palette")
+	}
+
+	// Unchanged frames are merged, 50 frames of 1/50 s.
+	delay := 0
+	for _, d := range anim.Delay {
+		delay += d
+	}
+	if delay != 100 || len(anim.Image) >= 50 {
+		t.Fatalf("Invalid GIF timing, %d frames of %d/100 s", len(anim.Image), delay)
+	}
+}
@@ -70,3 +70,43 @@ func TestSET_B_IX(t *testing.T) {
 	}
 
 }
+
+func TestM1Cycles(t *testing.T) {
+	hw := TestHw()
+
+	// Opcode fetches including the prefixed ones are M1 cycles, operands and
+	// the displacement are plain reads.
+	code := []uint8{
+		0x00,       // NOP
+		0xcb, 0x00, // RLC B
+		0xdd, 0x7e, 0x05, // LD A,(IX+5)
+		0xdd, 0xcb, 0x05, 0x06, // RLC (IX+5)
+	}
+	for i, b := range code {
+		hw.ram.Write(uint16(i), b)
+	}
+	hw.cpu.Reg.IX = 0x8000
+
+	bus := hw.cpu.Pin.Bus
+	var m1 []bool
+	hw.cpu.Pin.Bus = func() {
+		if hw.cpu.Pin.MREQ && hw.cpu.Pin.RD && hw.cpu.Pin.ADDR < uint16(len(code)) {
+			m1 = append(m1, hw.cpu.Pin.M1)
+		}
+		bus()
+	}
+
+	for i := 0; i < 4; i++ {
+		hw.cpu.Tick()
+	}
+
+	expected := []bool{true, true, true, true, true, false, true, true, false, false}
+	if len(m1) != len(expected) {
+		t.Fatalf("Expected %d fetches, got %v", len(expected), m1)
+	}
+	for i := range expected {
+		if m1[i] != expected[i] {
+			t.Fatalf("Invalid M1 of fetch %d: %v", i, m1)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"mutex/gumak/device"
+	"testing"
+)
+
+func TestIoBusDecoding(t *testing.T) {
+	var bus device.IoBus
+	var kempston device.Kempston
+
+	written := 0
+	bus.Register(0x0001, 0x0000, func(addr uint16) uint8 { return 0b10111111 }, func(addr uint16, value uint8) { written++ })
+	if kempston.Attached {
+		t.Fatalf("Kempston attached before Attach")
+	}
+	kempston.Attach(&bus)
+	if !kempston.Attached {
+		t.Fatalf("Kempston not attached")
+	}
+	bus.Floating = func(addr uint16) uint8 { return 0x42 }
+
+	// Any even port answers.
+	bus.Write(0x00fe, 0)
+	bus.Write(0x7ffe, 0)
+	bus.Write(0x00ff, 0)
+	if written != 2 {
+		t.Fatalf("Expected 2 writes, got %d", written)
+	}
+
+	kempston.Press(device.KEMPSTON_FIRE|device.KEMPSTON_UP, true)
+	if v := bus.Read(0x001f); v != 0b11000 {
+		t.Fatalf("Expected kempston 0x18, got 0x%02x", v)
+	}
+
+	// Both devices answer even port with A5-A7 low.
+	if v := bus.Read(0x001e); v != 0b11000 {
+		t.Fatalf("Expected AND of both devices 0x18, got 0x%02x", v)
+	}
+
+	if v := bus.Read(0x00ff); v != 0x42 {
+		t.Fatalf("Expected floating bus 0x42, got 0x%02x", v)
+	}
+}
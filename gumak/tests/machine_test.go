@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"mutex/gumak"
+	"mutex/gumak/device"
+	"testing"
+)
+
+func TestMachinesValid(t *testing.T) {
+	for _, m := range gumak.Machines() {
+		if err := m.Validate(); err != nil {
+			t.Fatalf("Invalid built-in machine: %s", err)
+		}
+	}
+}
+
+func TestRegisterMachine(t *testing.T) {
+	m, ok := gumak.FindMachine("48")
+	if !ok {
+		t.Fatalf("Machine 48 not found")
+	}
+
+	if gumak.RegisterMachine(m) == nil {
+		t.Fatalf("Duplicate machine registered")
+	}
+
+	m.Name = "48+ay"
+	m.Peripherals = append(m.Peripherals, gumak.PeripheralAY)
+
+	if err := gumak.RegisterMachine(m); err != nil {
+		t.Fatalf("Failed to register machine: %s", err)
+	}
+	t.Cleanup(func() { gumak.UnregisterMachine(m.Name) })
+
+	g, err := gumak.CreateNew("48+ay", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	g.Io.Write(0xfffd, 7)
+	g.Io.Write(0xbffd, 0x3f)
+
+	if g.Io.Read(0xfffd) != 0x3f || g.Ula.Is128K {
+		t.Fatalf("Invalid machine configuration")
+	}
+}
+
+func TestCustomPaging(t *testing.T) {
+	m, _ := gumak.FindMachine("128")
+
+	// Clone decoding the full address of the paging port.
+	m.Name = "128full"
+	m.Paging = device.Paging{
+		Port7ffd:    device.PortDecoding{Mask: 0xffff, Value: 0x7ffd},
+		FloatingBus: device.FLOATING_BUS_NONE,
+	}
+
+	g, err := gumak.CreateMachine(m, 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	paged := func(bank int) bool {
+		return &g.Ram.Page(3)[0] == &g.Ram.Bank(bank)[0]
+	}
+
+	g.Io.Write(0x3ffd, 1)
+	if !paged(0) {
+		t.Fatalf("Partially decoded port pages memory")
+	}
+
+	g.Io.Write(0x7ffd, 1)
+	if !paged(1) {
+		t.Fatalf("Paging port does not page memory")
+	}
+
+	if g.Io.Read(0x00ff) != 0xff {
+		t.Fatalf("Floating bus read on machine without it")
+	}
+}
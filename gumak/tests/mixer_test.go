@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"mutex/gumak/device"
+	"testing"
+)
+
+func TestMixerPanning(t *testing.T) {
+	var m device.Mixer
+	m.Init()
+
+	var sources [device.MIXER_SOURCES]float64
+	sources[device.MIXER_AY_A] = 0.5
+
+	if l, r := m.Mix(sources); l != 0.25 || r != 0.25 {
+		t.Fatalf("Mono: expected centered channel A, got %f %f", l, r)
+	}
+
+	m.SetPanning(device.PANNING_ABC)
+	if l, r := m.Mix(sources); l != 0.25 || r != 0 {
+		t.Fatalf("ABC: expected channel A on the left, got %f %f", l, r)
+	}
+
+	m.SetPanning(device.PANNING_BAC)
+	if l, r := m.Mix(sources); l != 0.25 || r != 0.25 {
+		t.Fatalf("BAC: expected centered channel A, got %f %f", l, r)
+	}
+
+	if err := m.ParsePanning("1,0,0.5"); err != nil || m.Panning() != device.PANNING_CUSTOM {
+		t.Fatalf("Failed to parse custom panning: %v", err)
+	}
+	if l, r := m.Mix(sources); l != 0 || r != 0.25 {
+		t.Fatalf("Custom: expected channel A on the right, got %f %f", l, r)
+	}
+
+	if m.ParsePanning("abd") == nil || m.ParsePanning("0,2,1") == nil {
+		t.Fatalf("Invalid panning accepted")
+	}
+}
+
+func TestMixerVolume(t *testing.T) {
+	var m device.Mixer
+	m.Init()
+
+	var sources [device.MIXER_SOURCES]float64
+	sources[device.MIXER_BEEPER] = 0.5
+	sources[device.MIXER_AY_B] = 0.5
+
+	m.Mute[device.MIXER_AY_B] = true
+	m.Volume[device.MIXER_BEEPER] = 0.5
+	if l, r := m.Mix(sources); l != 0.125 || r != 0.125 {
+		t.Fatalf("Expected muted channel B and half beeper, got %f %f", l, r)
+	}
+
+	m.Gain = 100
+	if l, r := m.Mix(sources); l != 1 || r != 1 {
+		t.Fatalf("Expected clipped output, got %f %f", l, r)
+	}
+}
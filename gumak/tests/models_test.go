@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"mutex/gumak"
+	"mutex/gumak/device"
+	"testing"
+)
+
+func Test16KUpperMemory(t *testing.T) {
+	g, err := gumak.CreateNew("16", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	for _, addr := range []uint16{0x8000, 0xc000, 0xffff} {
+		g.Ram.Write(addr, 0x12)
+		if v := g.Ram.Read(addr); v != 0xff {
+			t.Fatalf("Read of 0x%04x returned 0x%02x", addr, v)
+		}
+	}
+
+	for _, bank := range []int{0, 2} {
+		for _, v := range g.Ram.Bank(bank) {
+			if v != 0 {
+				t.Fatalf("Write stored into bank %d", bank)
+			}
+		}
+	}
+
+	// Reads float while the ULA fetches the display.
+	vram := g.Ram.Bank(device.BANK_VRAM)
+	for i := range vram[:6912] {
+		vram[i] = 0x55
+	}
+	g.Ula.FrameTState = func() int { return g.Machine.Timing.ScreenStart + 2 }
+	if v := g.Ram.Read(0x8000); v != 0x55 {
+		t.Fatalf("Read of 0x8000 during display fetch returned 0x%02x", v)
+	}
+
+	if g.Ram.Read(0x4000) != 0x55 {
+		t.Fatalf("Lower 16K of RAM not mapped")
+	}
+}
+
+func TestNtscTiming(t *testing.T) {
+	g, err := gumak.CreateNew("48ntsc", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	frame, intStart, intLength := nopFrame(g)
+	if frame != 224*264 || intStart != 0 || intLength != 32 {
+		t.Fatalf("Invalid frame length %d or interrupt %d+%d", frame, intStart, intLength)
+	}
+
+	if rate := g.FrameRate(); rate < 59 || rate > 60 {
+		t.Fatalf("Invalid frame rate %f", rate)
+	}
+}
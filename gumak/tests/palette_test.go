@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"mutex/gumak/device"
+	"strings"
+	"testing"
+)
+
+func TestParsePalette(t *testing.T) {
+	text := "; Test palette\n\n#000000\n0 0 224\n" + strings.Repeat("#ff8000\n", 13) + "255 255 255\n"
+
+	p, err := device.ParsePalette(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Failed to parse palette: %s", err)
+	}
+
+	if p[1] != (device.RGB{R: 0, G: 0, B: 224}) || p[2] != (device.RGB{R: 255, G: 128, B: 0}) || p[15] != (device.RGB{R: 255, G: 255, B: 255}) {
+		t.Fatalf("Invalid palette: %v", p)
+	}
+
+	for _, invalid := range []string{
+		strings.Repeat("0 0 0\n", 15),
+		strings.Repeat("0 0 0\n", 17),
+		strings.Repeat("0 0 0\n", 15) + "0 0 256\n",
+		strings.Repeat("0 0 0\n", 15) + "#12345\n",
+	} {
+		if _, err := device.ParsePalette(strings.NewReader(invalid)); err == nil {
+			t.Fatalf("Invalid palette accepted: %q", invalid)
+		}
+	}
+}
+
+func TestDefaultPalette(t *testing.T) {
+	if device.PaletteDefault[1] != (device.RGB{R: 0, G: 0, B: 224}) || device.PaletteDefault[12] != (device.RGB{R: 0, G: 255, B: 0}) {
+		t.Fatalf("Invalid default palette")
+	}
+}
+
+func TestMachinePalette(t *testing.T) {
+	ram := new(device.Ram)
+	ram.Init()
+	a, b := new(device.Ula), new(device.Ula)
+	a.Init(ram, &device.Beeper{}, device.PagingNone, device.Timing48K)
+	b.Init(ram, &device.Beeper{}, device.PagingNone, device.Timing48K)
+
+	if a.Palette != device.PaletteDefault || a.Frame.Palette != device.PaletteDefault {
+		t.Fatalf("Default palette not used")
+	}
+
+	// Palette of one ULA does not change the other one, the frame gets it
+	// at its end.
+	a.Palette = device.PaletteGreen
+	if a.Frame.Palette != device.PaletteDefault {
+		t.Fatalf("Palette changed before the end of the frame")
+	}
+
+	a.UpdateEndFrame()
+	b.UpdateEndFrame()
+	if a.Frame.Palette != device.PaletteGreen || b.Frame.Palette != device.PaletteDefault {
+		t.Fatalf("Invalid palettes of the frames")
+	}
+
+	a.Write(0xfe, 4)
+	a.UpdateEndFrame()
+	rgba := make([]byte, 4*len(a.Frame.Pixels))
+	device.ConvertFrame(rgba, 4*a.Frame.Res.W, device.PIXEL_FORMAT_RGBA, a.Frame)
+	if c := device.PaletteGreen[4]; rgba[0] != c.R || rgba[1] != c.G || rgba[2] != c.B {
+		t.Fatalf("Frame not converted by its palette: %v", rgba[:4])
+	}
+}
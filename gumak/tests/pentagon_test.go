@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"mutex/gumak"
+	"mutex/gumak/device"
+	"testing"
+)
+
+// Runs NOPs with interrupts disabled from a frame start, returns T-states
+// of the next frame and T-state and length of the active INT.
+func nopFrame(g *gumak.Gumak) (frame, intStart, intLength int) {
+	g.Cpu.Reg.PC = 0x6000
+	g.Cpu.IFF1, g.Cpu.IFF2 = false, false
+
+	for !g.Tick() {
+	}
+	intStart = -1
+	for {
+		end := g.Tick()
+		if g.Cpu.Pin.INT {
+			if intStart < 0 {
+				intStart = frame
+			}
+			intLength += 4
+		}
+		frame += 4
+		if end {
+			return
+		}
+	}
+}
+
+func TestPentagonTiming(t *testing.T) {
+	g, err := gumak.CreateNew("pentagon", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	frame, intStart, intLength := nopFrame(g)
+	if frame != 224*320 || intStart != 0 || intLength != 32 {
+		t.Fatalf("Invalid frame length %d or interrupt %d+%d", frame, intStart, intLength)
+	}
+
+	timing := device.TimingPentagon
+	for tState := 0; tState < timing.TStatesPerFrame(); tState++ {
+		if timing.Contention(tState) != 0 || timing.IoContention(0x40fe, tState, true) != 0 {
+			t.Fatalf("Contention at T-state %d", tState)
+		}
+	}
+
+	for addr := 0; addr < 0x10000; addr += 0x4000 {
+		if g.Ram.Contended(uint16(addr)) {
+			t.Fatalf("Contended memory at 0x%04x", addr)
+		}
+	}
+}
+
+func TestPentagonFloatingBus(t *testing.T) {
+	read := func(model string) uint8 {
+		g, err := gumak.CreateNew(model, 44100)
+		if err != nil {
+			t.Fatalf("Failed to create machine: %s", err)
+		}
+
+		vram := g.Ram.Bank(device.BANK_VRAM)
+		for i := range vram[:6912] {
+			vram[i] = 0x55
+		}
+
+		// Beam fetches the first display cell.
+		start := g.Machine.Timing.ScreenStart
+		g.Ula.FrameTState = func() int { return start + 2 }
+		return g.Io.Read(0x40ff)
+	}
+
+	if read("128") != 0x55 {
+		t.Fatalf("No floating bus on 128K")
+	}
+
+	if v := read("pentagon"); v != 0xff {
+		t.Fatalf("Floating bus on Pentagon: 0x%02x", v)
+	}
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"mutex/gumak/formats"
+	"mutex/gumak/player"
+	"reflect"
+	"testing"
+)
+
+// AY file with one song, its interrupt routine writes frame counter to
+// tone A period and beeps.
+func testAyFile() []byte {
+	data := make([]byte, 52)
+	copy(data, "ZXAYEMUL")
+
+	pointer := func(at, target int) {
+		binary.BigEndian.PutUint16(data[at:], uint16(target-at))
+	}
+	text := func(at int, s string) {
+		pointer(at, len(data))
+		data = append(data, append([]byte(s), 0)...)
+	}
+
+	pointer(18, 20)                            // Songs.
+	pointer(22, 24)                            // Song data.
+	binary.BigEndian.PutUint16(data[28:], 100) // Length.
+	binary.BigEndian.PutUint16(data[30:], 50)  // Fade.
+	pointer(34, 38)                            // Points.
+	pointer(36, 44)                            // Blocks.
+	binary.BigEndian.PutUint16(data[38:], 0xff00)
+	binary.BigEndian.PutUint16(data[40:], 0x8000)
+	binary.BigEndian.PutUint16(data[42:], 0x8001)
+
+	code := []byte{
+		0xc9,             // init: RET
+		0x01, 0xfd, 0xff, // LD BC,0xfffd
+		0xaf,       // XOR A
+		0xed, 0x79, // OUT (C),A
+		0x3a, 0x00, 0x90, // LD A,(0x9000)
+		0x3c,             // INC A
+		0x32, 0x00, 0x90, // LD (0x9000),A
+		0x06, 0xbf, // LD B,0xbf
+		0xed, 0x79, // OUT (C),A
+		0xe6, 0x10, // AND 0x10
+		0xd3, 0xfe, // OUT (0xfe),A
+		0xc9, // RET
+	}
+	binary.BigEndian.PutUint16(data[44:], 0x8000)
+	binary.BigEndian.PutUint16(data[46:], uint16(len(code)))
+	pointer(48, len(data))
+	data = append(data, code...)
+
+	text(12, "Author")
+	text(14, "Misc")
+	text(20, "Song")
+	return data
+}
+
+func TestLoadAy(t *testing.T) {
+	ay, err := formats.LoadAy(bytes.NewReader(testAyFile()))
+	if err != nil {
+		t.Fatalf("Failed to load AY: %s", err)
+	}
+
+	if ay.Author != "Author" || ay.Misc != "Misc" || len(ay.Songs) != 1 {
+		t.Fatalf("Invalid AY header %+v", ay)
+	}
+
+	song := ay.Songs[0]
+	if song.Name != "Song" || song.Length != 100 || song.Fade != 50 || song.Stack != 0xff00 ||
+		song.Init != 0x8000 || song.Interrupt != 0x8001 || len(song.Blocks) != 1 || song.Blocks[0].Address != 0x8000 {
+		t.Fatalf("Invalid AY song %+v", song)
+	}
+
+	if _, err := formats.LoadAy(bytes.NewReader([]byte("ZXAYEMUL"))); err == nil {
+		t.Fatalf("Truncated AY file loaded")
+	}
+}
+
+func TestPlayerAy(t *testing.T) {
+	p, err := player.Load("test.ay", bytes.NewReader(testAyFile()), 44100)
+	if err != nil {
+		t.Fatalf("Failed to load AY: %s", err)
+	}
+
+	if p.Songs() != 1 || p.SongName() != "Song" || p.Author != "Author" {
+		t.Fatalf("Invalid song info")
+	}
+
+	if math.Abs(p.Length()-2) > 0.01 {
+		t.Fatalf("Expected length 2 s, got %f", p.Length())
+	}
+
+	frames := 0
+	buffer := make([]float32, 2*44100)
+	p.ReadAudio(buffer, func() { frames++ })
+
+	// The interrupt routine counts the frames into tone A period.
+	if frames < 49 || frames > 51 || p.Ay.Registers()[0] != uint8(frames) {
+		t.Fatalf("Expected 50 frames, got %d, register 0 is %d", frames, p.Ay.Registers()[0])
+	}
+
+	p.ReadAudio(buffer, nil)
+	if !p.Finished() {
+		t.Fatalf("Song not finished after 2 s")
+	}
+	if l, r := p.PopAudioFloat(); l != 0 || r != 0 {
+		t.Fatalf("Expected silence after the song")
+	}
+}
+
+func TestPsgRoundTrip(t *testing.T) {
+	frames := [][]formats.AyWrite{{{Reg: 0, Value: 1}, {Reg: 13, Value: 8}}, nil, nil, nil, nil, nil, {{Reg: 7, Value: 0x38}}, nil}
+
+	var buffer bytes.Buffer
+	if err := formats.SavePsg(&buffer, frames); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := formats.LoadPsg(bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to load PSG: %s", err)
+	}
+	if !reflect.DeepEqual(frames, loaded) {
+		t.Fatalf("Invalid PSG frames %v", loaded)
+	}
+
+	p, err := player.Load("test.psg", bytes.NewReader(buffer.Bytes()), 44100)
+	if err != nil {
+		t.Fatalf("Failed to play PSG: %s", err)
+	}
+
+	for !p.Finished() {
+		p.PopAudioFloat()
+	}
+	if regs := p.Ay.Registers(); regs[0] != 1 || regs[7] != 0x38 || regs[13] != 8 {
+		t.Fatalf("Invalid registers after the song: % x", regs)
+	}
+}
+
+func TestYmRoundTrip(t *testing.T) {
+	song := &formats.YmSong{Version: formats.YM_VERSION_6, Clock: 2000000, Rate: 50, Name: "Name", Author: "Author", Comment: "Comment"}
+	for i := 0; i < 10; i++ {
+		var regs [formats.YM_REGISTERS]uint8
+		regs[0], regs[8], regs[13] = uint8(i), 15, formats.YM_ENVELOPE_NO_WRITE
+		song.Frames = append(song.Frames, regs)
+	}
+
+	var buffer bytes.Buffer
+	if err := formats.SaveYm(&buffer, song); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := formats.LoadYm(bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to load YM: %s", err)
+	}
+	if !reflect.DeepEqual(song, loaded) {
+		t.Fatalf("Invalid YM song %+v", loaded)
+	}
+
+	p, err := player.Load("test.ym", bytes.NewReader(buffer.Bytes()), 44100)
+	if err != nil {
+		t.Fatalf("Failed to play YM: %s", err)
+	}
+
+	for !p.Finished() {
+		p.PopAudioFloat()
+	}
+	if regs := p.Ay.Registers(); regs[0] != 9 || regs[8] != 15 {
+		t.Fatalf("Invalid registers after the song: % x", regs)
+	}
+}
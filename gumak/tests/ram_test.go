@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"mutex/gumak/device"
+	"testing"
+)
+
+func TestPlus3SpecialPaging(t *testing.T) {
+	var ram device.Ram
+	var ula device.Ula
+	var io device.IoBus
+
+	ram.SetContendedBanks(device.CONTENDED_BANKS_PLUS3)
+	ram.Init()
+	ula.Init(&ram, &device.Beeper{}, device.PagingPlus3, device.TimingPlus3)
+	ula.Attach(&io)
+
+	for bank := 0; bank < 8; bank++ {
+		ram.Bank(bank)[0] = uint8(bank)
+	}
+
+	configs := [4][4]uint8{
+		{0, 1, 2, 3},
+		{4, 5, 6, 7},
+		{4, 5, 6, 3},
+		{4, 7, 6, 3},
+	}
+
+	for config, banks := range configs {
+		io.Write(0x1ffd, uint8(config<<1)|0b1)
+
+		for page, bank := range banks {
+			if v := ram.Read(uint16(page) << 14); v != bank {
+				t.Fatalf("Config %d: expected bank %d in page %d, got %d", config, bank, page, v)
+			}
+		}
+	}
+
+	// Back to normal paging, ROM 3 and bank 7 at 0xc000.
+	io.Write(0x7ffd, 0b10111)
+	io.Write(0x1ffd, 0b100)
+
+	if ram.Read(0xc000) != 7 {
+		t.Fatalf("Expected bank 7 at 0xc000, got %d", ram.Read(0xc000))
+	}
+
+	if !ram.Contended(0xc000) || !ram.Contended(0x4000) || ram.Contended(0x8000) {
+		t.Fatalf("Invalid contended pages")
+	}
+}
+
+func TestRomWriteProtection(t *testing.T) {
+	var ram device.Ram
+	ram.SetContendedBanks(device.CONTENDED_BANKS_PLUS3)
+	ram.Init()
+	ram.SetRomContent(0, []byte{0xf3}, 0)
+
+	writes := 0
+	ram.RomWrite = func(addr uint16, value uint8) {
+		writes++
+	}
+
+	ram.Write(0x0000, 0xaa)
+	if ram.Read(0x0000) != 0xf3 || writes != 1 {
+		t.Fatalf("ROM write not ignored")
+	}
+
+	if ram.PageAttributes(0) != device.PAGE_READ_ONLY {
+		t.Fatalf("Invalid ROM page attributes %b", ram.PageAttributes(0))
+	}
+
+	// RAM in ROM area.
+	ram.SetSpecialPaging(true, 1)
+	ram.Write(0x0000, 0xaa)
+	if ram.Read(0x0000) != 0xaa || writes != 1 {
+		t.Fatalf("Write into RAM in ROM area failed")
+	}
+
+	if ram.PageAttributes(0) != device.PAGE_RAM|device.PAGE_CONTENDED {
+		t.Fatalf("Invalid RAM page attributes %b", ram.PageAttributes(0))
+	}
+
+	ram.SetSpecialPaging(false, 0)
+	ram.SetRomWritable(true)
+	ram.Write(0x0000, 0x55)
+	if ram.Read(0x0000) != 0x55 || writes != 2 {
+		t.Fatalf("Writable ROM not written")
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mutex/gumak"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func recordFrames(t *testing.T, file string, frames int) *gumak.Gumak {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	if err := g.StartRecording(file); err != nil {
+		t.Fatalf("Failed to start recording: %s", err)
+	}
+
+	for frames > 0 {
+		for !g.AudioSampleReady() {
+			if g.Tick() {
+				frames--
+			}
+		}
+		g.PopAudioSample()
+	}
+
+	if err := g.StopRecording(); err != nil {
+		t.Fatalf("Failed to stop recording: %s", err)
+	}
+
+	return g
+}
+
+func TestRecordAvi(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.avi")
+	recordFrames(t, file, 10)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "AVI " {
+		t.Fatalf("Invalid AVI header")
+	}
+
+	if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Fatalf("Invalid RIFF size %d, file size %d", size, len(data))
+	}
+
+	// Total frames of the main header.
+	if frames := binary.LittleEndian.Uint32(data[48:]); frames != 10 {
+		t.Fatalf("Invalid frame count %d", frames)
+	}
+
+	if !bytes.Contains(data, []byte("idx1")) {
+		t.Fatalf("Missing index")
+	}
+}
+
+func TestRecordY4m(t *testing.T) {
+	dir := t.TempDir()
+	g := recordFrames(t, filepath.Join(dir, "test.y4m"), 5)
+
+	video, err := os.ReadFile(filepath.Join(dir, "test.y4m"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, h := g.FrameResolution()
+	header := []byte("YUV4MPEG2 W320 H240 F3500000:69888 Ip A1:1 C444 XCOLORRANGE=FULL\n")
+	if !bytes.HasPrefix(video, header) || len(video) != len(header)+5*(6+3*w*h) {
+		t.Fatalf("Invalid Y4M stream, size %d", len(video))
+	}
+
+	audio, err := os.ReadFile(filepath.Join(dir, "test.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// About 5 frames of 44.1 kHz stereo 16-bit samples.
+	samples := int(binary.LittleEndian.Uint32(audio[40:])) / 4
+	if string(audio[0:4]) != "RIFF" || samples < 4400 || samples > 4420 {
+		t.Fatalf("Invalid WAV, %d samples", samples)
+	}
+}
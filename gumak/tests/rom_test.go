@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"mutex/gumak"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCustomRom(t *testing.T) {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	rom := make([]byte, 0x4000)
+	rom[0] = 0x76 // HALT
+
+	if g.LoadRomReader(0, bytes.NewReader(rom[:0x3fff]), 0) == nil {
+		t.Fatalf("Short ROM accepted")
+	}
+
+	if g.LoadRomReader(0, bytes.NewReader(append(rom, 0)), 0) == nil {
+		t.Fatalf("Long ROM accepted")
+	}
+
+	if g.LoadRomReader(1, bytes.NewReader(rom), 0) == nil {
+		t.Fatalf("ROM accepted into slot not used by 48K")
+	}
+
+	if g.LoadRomReader(0, bytes.NewReader(rom), 0x12345678) == nil {
+		t.Fatalf("ROM with invalid checksum accepted")
+	}
+
+	if g.Ram.Read(0) == 0x76 {
+		t.Fatalf("Invalid ROM was loaded")
+	}
+
+	if err := g.LoadRomReader(0, bytes.NewReader(rom), crc32.ChecksumIEEE(rom)); err != nil {
+		t.Fatalf("Failed to load ROM: %s", err)
+	}
+
+	if err := g.Reset(); err != nil {
+		t.Fatalf("Reset failed: %s", err)
+	}
+
+	if g.Ram.Read(0) != 0x76 {
+		t.Fatalf("Custom ROM not kept after reset")
+	}
+
+	if err := g.ResetRoms(); err != nil {
+		t.Fatalf("Reset failed: %s", err)
+	}
+
+	if g.Ram.Read(0) != 0xf3 {
+		t.Fatalf("Original ROM not restored")
+	}
+}
+
+// +3 machine with ROMs in temporary directory, the first byte of ROM n is
+// 0x10+n.
+func plus3Machine(t *testing.T) gumak.Machine {
+	dir := t.TempDir()
+	for i := 0; i < 4; i++ {
+		rom := make([]byte, 0x4000)
+		rom[0] = uint8(0x10 + i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("plus3-%d.rom", i)), rom, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, _ := gumak.FindMachine("+3")
+	m.RomDir = dir
+	return m
+}
+
+func TestRomDirectoryAtCreation(t *testing.T) {
+	_, err := gumak.CreateNew("+3", 44100)
+	if err == nil {
+		t.Skip("+3 ROMs are embedded")
+	}
+	if !strings.Contains(err.Error(), "plus3-0.rom") || !strings.Contains(err.Error(), "RomDir") {
+		t.Fatalf("Missing ROMs not reported: %s", err)
+	}
+
+	m := plus3Machine(t)
+	dir := m.RomDir
+	g, err := gumak.CreateMachine(m, 44100)
+	if err != nil {
+		t.Fatalf("Failed to create +3 from ROM directory: %s", err)
+	}
+	if g.Ram.Read(0) != 0x10 {
+		t.Fatalf("ROM 0 not loaded from directory")
+	}
+
+	// Custom image replaces ROM which is missing in the directory.
+	if err := os.Remove(filepath.Join(dir, "plus3-3.rom")); err != nil {
+		t.Fatal(err)
+	}
+	rom := make([]byte, 0x4000)
+	rom[0] = 0x76
+	m.RomImages = []gumak.RomImage{{Slot: 3, Data: rom, Checksum: crc32.ChecksumIEEE(rom)}}
+	if _, err := gumak.CreateMachine(m, 44100); err != nil {
+		t.Fatalf("Failed to create +3 with custom ROM: %s", err)
+	}
+
+	m.RomImages[0].Checksum++
+	if _, err := gumak.CreateMachine(m, 44100); err == nil {
+		t.Fatalf("Custom ROM with invalid checksum accepted")
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"bytes"
+	"image/png"
+	"mutex/gumak"
+	"mutex/gumak/device"
+	"mutex/gumak/formats"
+	"testing"
+)
+
+func TestScreenFile(t *testing.T) {
+	m, _ := gumak.FindMachine("128")
+	g, err := gumak.CreateMachine(m, 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	scr := make([]byte, formats.SCR_SIZE)
+	for i := range scr {
+		scr[i] = uint8(i)
+	}
+
+	// Shadow screen.
+	g.Ula.VRamBank = device.BANK_VRAM_SHADOW
+	if err := g.LoadScreen("test.scr", bytes.NewReader(scr)); err != nil {
+		t.Fatalf("Failed to load screen: %s", err)
+	}
+
+	if !bytes.Equal(g.Ram.Bank(device.BANK_VRAM_SHADOW)[:formats.SCR_SIZE], scr) {
+		t.Fatalf("Screen not loaded into shadow VRAM")
+	}
+
+	var out bytes.Buffer
+	if err := g.SaveScreen("test.scr", &out); err != nil {
+		t.Fatalf("Failed to save screen: %s", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), scr) {
+		t.Fatalf("Saved screen differs")
+	}
+
+	if g.LoadScreen("test.scr", bytes.NewReader(scr[:100])) == nil {
+		t.Fatalf("Short screen accepted")
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	g := createUlaPlus(t)
+	g.Ula.UpdateEndFrame()
+
+	var out bytes.Buffer
+	if err := g.SaveScreenshot("test.png", &out); err != nil {
+		t.Fatalf("Failed to save screenshot: %s", err)
+	}
+
+	img, err := png.Decode(&out)
+	if err != nil {
+		t.Fatalf("Invalid PNG: %s", err)
+	}
+
+	w, h := g.FrameResolution()
+	if b := img.Bounds(); b.Dx() != w || b.Dy() != h {
+		t.Fatalf("Invalid screenshot size %dx%d", b.Dx(), b.Dy())
+	}
+}
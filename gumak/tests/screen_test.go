@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"bytes"
+	"mutex/gumak"
+	"mutex/gumak/device"
+	"testing"
+)
+
+func testUla() (*device.Ram, *device.Ula) {
+	ram := new(device.Ram)
+	ula := new(device.Ula)
+
+	ram.Init()
+	ula.Init(ram, &device.Beeper{}, device.PagingNone, device.Timing48K)
+
+	return ram, ula
+}
+
+// Pixels of the display area line.
+func displayLine(screen *device.Screen, line int) []uint8 {
+	left := (screen.Res.W - device.DisplayRes.W) / 2
+	top := (screen.Res.H - device.DisplayRes.H) / 2
+
+	offset := (top+line)*screen.Res.W + left
+	return screen.Pixels[offset : offset+device.DisplayRes.W]
+}
+
+func TestScreenMidFrameChange(t *testing.T) {
+	ram, ula := testUla()
+
+	vram := ram.Bank(device.BANK_VRAM)
+	vram[0] = 0xf0        // Bitmap of line 0, column 0.
+	vram[6144] = 0b010001 // Blue ink, red paper.
+
+	// Beam is at the end of the first line.
+	ula.Update(device.Timing48K.ScreenStart + device.Timing48K.TStatesPerLine - 1)
+	vram[6144] = 0b100011 // Magenta ink, green paper.
+	ula.UpdateEndFrame()
+
+	line0 := displayLine(ula.Frame, 0)
+	line1 := displayLine(ula.Frame, 1)
+
+	if line0[0] != 1 || line0[7] != 2 {
+		t.Fatalf("Invalid colours of line 0: %v", line0[:8])
+	}
+
+	if line1[0] != 4 || line1[7] != 4 {
+		t.Fatalf("Invalid colours of line 1: %v", line1[:8])
+	}
+}
+
+func TestBorderStripes(t *testing.T) {
+	_, ula := testUla()
+	timing := device.Timing48K
+
+	// Change border in the middle of the first display line.
+	ula.Write(0xfe, 2)
+	ula.Update(timing.ScreenStart + 64)
+	ula.Write(0xfe, 5)
+	ula.UpdateEndFrame()
+
+	res := ula.Frame.Res
+	top := (res.H - device.DisplayRes.H) / 2
+
+	line := func(y int) []uint8 {
+		return ula.Frame.Pixels[y*res.W : (y+1)*res.W]
+	}
+
+	if line(0)[0] != 2 || line(top - 1)[res.W-1] != 2 {
+		t.Fatalf("Invalid colour of the top border")
+	}
+
+	// Left border of the first display line is drawn before the change, the
+	// right one after it.
+	if line(top)[0] != 2 || line(top)[res.W-1] != 5 {
+		t.Fatalf("Invalid border colour of the display line: %d %d", line(top)[0], line(top)[res.W-1])
+	}
+
+	if line(res.H - 1)[0] != 5 {
+		t.Fatalf("Invalid colour of the bottom border")
+	}
+
+	if ula.SetScreenRes(device.Resolution{W: 320, H: 400}) == nil {
+		t.Fatalf("Border higher than the frame accepted")
+	}
+
+	if err := ula.SetScreenRes(device.Resolution{W: 352, H: 296}); err != nil {
+		t.Fatalf("Full border rejected: %s", err)
+	}
+}
+
+func TestRenderDisplay(t *testing.T) {
+	ram, ula := testUla()
+
+	vram := ram.Bank(device.BANK_VRAM)
+	for i := 0; i < 6912; i++ {
+		vram[i] = uint8(i * 7)
+	}
+	ula.UpdateEndFrame()
+
+	w, h := device.DisplayRes.W, device.DisplayRes.H
+	indexed := make([]byte, w*h)
+	rgba := make([]byte, 4*w*h)
+	device.RenderDisplay(indexed, w, device.PIXEL_FORMAT_INDEXED, &device.PaletteDim, vram, false)
+	device.RenderDisplay(rgba, 4*w, device.PIXEL_FORMAT_RGBA, &device.PaletteDim, vram, false)
+
+	for y := 0; y < h; y++ {
+		line := displayLine(ula.Frame, y)
+		for x := 0; x < w; x++ {
+			p := indexed[y*w+x]
+			if p != line[x] {
+				t.Fatalf("Pixel [%d, %d] differs from ULA frame: %d != %d", x, y, p, line[x])
+			}
+
+			c := device.PaletteDim[p]
+			if o := 4 * (y*w + x); rgba[o] != c.R || rgba[o+1] != c.G || rgba[o+2] != c.B || rgba[o+3] != 255 {
+				t.Fatalf("Invalid RGBA pixel [%d, %d]", x, y)
+			}
+		}
+	}
+}
+
+func TestSnow(t *testing.T) {
+	ram, ula := testUla()
+
+	vram := ram.Bank(device.BANK_VRAM)
+	vram[0x0010] = 0xff
+	vram[0x1810] = 0b000011 // Magenta ink.
+
+	// Refresh with R=0x10 during the first fetch, second cell is not affected.
+	ula.Snow(device.Timing48K.ScreenStart+1, 0x10)
+	ula.UpdateEndFrame()
+
+	line := displayLine(ula.Frame, 0)
+	if line[0] != 3 || line[8] != 0 {
+		t.Fatalf("Invalid snow: %v", line[:16])
+	}
+
+	// Next frame is clean.
+	ula.UpdateEndFrame()
+	if displayLine(ula.Frame, 0)[0] != 0 {
+		t.Fatalf("Snow not cleared")
+	}
+
+	// No snow on Pentagon.
+	pentagon := new(device.Ula)
+	pentagon.Init(ram, &device.Beeper{}, device.PagingPentagon, device.TimingPentagon)
+	pentagon.Snow(device.TimingPentagon.ScreenStart+1, 0x10)
+	pentagon.UpdateEndFrame()
+	if displayLine(pentagon.Frame, 0)[0] != 0 {
+		t.Fatalf("Snow on Pentagon")
+	}
+}
+
+func TestSnowRefresh(t *testing.T) {
+	frame := func(i uint8) []uint8 {
+		g, err := gumak.CreateNew("48", 44100)
+		if err != nil {
+			t.Fatalf("Failed to create machine: %s", err)
+		}
+
+		vram := g.Ram.Bank(device.BANK_VRAM)
+		for addr := 0; addr < 0x1800; addr++ {
+			vram[addr] = uint8(addr)
+		}
+		for addr := 0x1800; addr < 0x1b00; addr++ {
+			vram[addr] = 0b000111 // White ink.
+		}
+
+		g.Cpu.Reg.I = i
+		nopFrame(g)
+		return g.Ula.Frame.Pixels
+	}
+
+	// Refresh of the contended fetches with I in the screen memory.
+	if bytes.Equal(frame(0x00), frame(0x40)) {
+		t.Fatalf("No snow with I=0x40")
+	}
+	if !bytes.Equal(frame(0x00), frame(0x80)) {
+		t.Fatalf("Snow with I=0x80")
+	}
+}
+
+func TestPentagonFullBorder(t *testing.T) {
+	ram := new(device.Ram)
+	ram.Init()
+	ula := new(device.Ula)
+	if err := ula.Init(ram, &device.Beeper{}, device.PagingPentagon, device.TimingPentagon); err != nil {
+		t.Fatalf("Failed to init Pentagon ULA: %s", err)
+	}
+
+	// Bottom border of Pentagon has 48 lines, the rest is padded.
+	if err := ula.SetScreenRes(device.Resolution{W: 352, H: 296}); err != nil {
+		t.Fatalf("Full border rejected: %s", err)
+	}
+
+	ula.Write(0xfe, 3)
+	ula.UpdateEndFrame()
+
+	res := ula.Frame.Res
+	for y := res.H - 4; y < res.H; y++ {
+		for _, pixel := range ula.Frame.Pixels[y*res.W : (y+1)*res.W] {
+			if pixel != 3 {
+				t.Fatalf("Invalid colour %d of padded border line %d", pixel, y)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"bytes"
+	"mutex/gumak"
+	"mutex/gumak/formats"
+	"testing"
+)
+
+func TestSzxMachineId(t *testing.T) {
+	g, err := gumak.CreateNew("128", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	for _, c := range []struct {
+		id uint8
+		ok bool
+	}{
+		{formats.SZX_MACHINE_128K, true},
+		{formats.SZX_MACHINE_PLUS2, true},
+		{formats.SZX_MACHINE_PLUS3, false},
+		{formats.SZX_MACHINE_PENTAGON, false},
+		{formats.SZX_MACHINE_48K, false},
+	} {
+		header := []byte{'Z', 'X', 'S', 'T', 1, 4, c.id, 0}
+		err := g.LoadSnapshot("test.szx", bytes.NewReader(header))
+		if (err == nil) != c.ok {
+			t.Fatalf("Snapshot of machine %d: %v", c.id, err)
+		}
+	}
+}
+
+func TestSzx16K(t *testing.T) {
+	g, err := gumak.CreateNew("16", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+	g.Ram.Write(0x4000, 0xaa)
+
+	var buffer bytes.Buffer
+	if err := g.SaveSnapshot("test.szx", &buffer); err != nil {
+		t.Fatalf("Failed to save snapshot: %s", err)
+	}
+
+	data := buffer.Bytes()
+	if data[6] != formats.SZX_MACHINE_16K || bytes.Count(data, []byte("RAMP")) != 1 {
+		t.Fatalf("16K snapshot has to contain only bank 5")
+	}
+
+	loaded, _ := gumak.CreateNew("16", 44100)
+	if err := loaded.LoadSnapshot("test.szx", &buffer); err != nil {
+		t.Fatalf("Failed to load snapshot: %s", err)
+	}
+	if loaded.Ram.Read(0x4000) != 0xaa {
+		t.Fatalf("Invalid RAM content")
+	}
+}
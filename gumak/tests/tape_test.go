@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"mutex/gumak"
+	"mutex/gumak/device"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Peak to peak level of the tape source over seconds of audio.
+func tapeLevel(t *testing.T, mute bool) (float32, *gumak.Gumak) {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	// Header block, 19 bytes.
+	tap := append([]byte{19, 0, 0x00}, make([]byte, 18)...)
+	file := filepath.Join(t.TempDir(), "test.tap")
+	if err := os.WriteFile(file, tap, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g.FastTape = false
+	g.Mixer.Mute[device.MIXER_BEEPER] = true
+	g.Mixer.Mute[device.MIXER_TAPE] = mute
+	if err := g.PlayTape(file); err != nil {
+		t.Fatalf("Failed to play tape: %s", err)
+	}
+
+	buffer := make([]float32, 2*44100)
+	g.ReadAudio(buffer, nil)
+
+	low, high := float32(0), float32(0)
+	for _, v := range buffer {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+
+	return high - low, g
+}
+
+func TestTapeSound(t *testing.T) {
+	level, g := tapeLevel(t, false)
+	if level < 0.2 {
+		t.Fatalf("Tape loading is silent, level %f", level)
+	}
+
+	// Header leader alone is 5 s in real time.
+	if !g.Ula.Tape.Running {
+		t.Fatalf("Tape finished in 1 s")
+	}
+
+	if level, _ := tapeLevel(t, true); level != 0 {
+		t.Fatalf("Muted tape is heard, level %f", level)
+	}
+}
+
+func TestWaitTapeLoaded(t *testing.T) {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	tap := append([]byte{19, 0, 0x00}, make([]byte, 18)...)
+	file := filepath.Join(t.TempDir(), "test.tap")
+	if err := os.WriteFile(file, tap, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.WaitTapeLoaded() {
+		t.Fatalf("Waited without tape")
+	}
+
+	if err := g.PlayTape(file); err != nil {
+		t.Fatalf("Failed to play tape: %s", err)
+	}
+
+	g.Tick()
+	if !g.WaitTapeLoaded() || g.Ula.Tape.Running {
+		t.Fatalf("Tape loading not waited for")
+	}
+
+	if g.WaitTapeLoaded() {
+		t.Fatalf("Waited after the tape finished")
+	}
+}
+
+func TestReadAudioFastTape(t *testing.T) {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	// Data block of 8 KB, half a minute of loading.
+	tap := append([]byte{0x02, 0x20, 0xff}, make([]byte, 0x2000)...)
+	tap = append(tap, 0xff) // Checksum.
+	file := filepath.Join(t.TempDir(), "test.tap")
+	if err := os.WriteFile(file, tap, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.PlayTape(file); err != nil {
+		t.Fatalf("Failed to play tape: %s", err)
+	}
+
+	// The loading is silent, the buffer is filled without waiting for it.
+	buffer := make([]float32, 2*4410)
+	for i := range buffer {
+		buffer[i] = 1
+	}
+	g.ReadAudio(buffer, nil)
+	for _, v := range buffer {
+		if v != 0 {
+			t.Fatalf("Fast loading is heard")
+		}
+	}
+
+	if !g.WaitTapeLoaded() {
+		t.Fatalf("Tape loaded before ReadAudio returned")
+	}
+}
@@ -15,6 +15,8 @@ func TestHw() *Hardware {
 	hw.cpu.Init(35000000, 224*312, nil)
 	hw.cpu.Reset()
 	hw.ram.Init()
+	// Tests place the code at 0x0000.
+	hw.ram.SetRomWritable(true)
 
 	hw.cpu.Pin.Bus = func() {
 		if hw.cpu.Pin.MREQ {
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"mutex/gumak/device"
+	"testing"
+)
+
+func timexUla() (*device.Ram, *device.Ula, *device.IoBus) {
+	ram, ula := testUla()
+	io := new(device.IoBus)
+
+	ula.Timex = new(device.Timex)
+	ula.Timex.Attach(io)
+	ula.Attach(io)
+
+	return ram, ula, io
+}
+
+func TestTimexHiColor(t *testing.T) {
+	ram, ula, io := timexUla()
+	vram := ram.Bank(device.BANK_VRAM)
+
+	io.Write(0x00ff, device.TIMEX_SCREEN_HICOLOR)
+	if io.Read(0x00ff) != device.TIMEX_SCREEN_HICOLOR {
+		t.Fatalf("Invalid port 0xff readback")
+	}
+
+	// Attribute of each pixel line is at the bitmap offset + 0x2000.
+	vram[0x0000] = 0xff
+	vram[0x0100] = 0xff
+	vram[0x2000] = 0b000001
+	vram[0x2100] = 0b000010
+	ula.UpdateEndFrame()
+
+	if displayLine(ula.Frame, 0)[0] != 1 || displayLine(ula.Frame, 1)[0] != 2 {
+		t.Fatalf("Invalid hi-colour attributes")
+	}
+}
+
+func TestTimexSecondScreen(t *testing.T) {
+	ram, ula, io := timexUla()
+	vram := ram.Bank(device.BANK_VRAM)
+
+	io.Write(0x00ff, device.TIMEX_SCREEN_SECOND)
+	vram[0x2000] = 0xff
+	vram[0x3800] = 0b000100
+	ula.UpdateEndFrame()
+
+	if displayLine(ula.Frame, 0)[0] != 4 {
+		t.Fatalf("Invalid second screen")
+	}
+}
+
+func TestTimexHiRes(t *testing.T) {
+	ram, ula, io := timexUla()
+	vram := ram.Bank(device.BANK_VRAM)
+
+	// Blue ink, yellow paper.
+	io.Write(0x00ff, device.TIMEX_SCREEN_HIRES|0b001000)
+	vram[0x0000] = 0x80
+	vram[0x2000] = 0x01
+
+	// The frame started in the standard mode.
+	ula.UpdateEndFrame()
+	if ula.Frame.HiRes {
+		t.Fatalf("Frame started in standard mode is hi-res")
+	}
+
+	ula.UpdateEndFrame()
+	res := ula.Frame.Res
+	if !ula.Frame.HiRes || res.W != 2*device.ScreenRes.W {
+		t.Fatalf("Invalid hi-res frame %dx%d", res.W, res.H)
+	}
+
+	top := (res.H - device.DisplayRes.H) / 2
+	left := (res.W - 2*device.DisplayRes.W) / 2
+	line := ula.Frame.Pixels[top*res.W+left:]
+
+	if line[0] != 1 || line[1] != 6 || line[14] != 6 || line[15] != 1 {
+		t.Fatalf("Invalid hi-res pixels: %v", line[:16])
+	}
+
+	if ula.Frame.Pixels[0] != 6 {
+		t.Fatalf("Border has not paper colour")
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bytes"
+	"mutex/gumak"
+	"mutex/gumak/device"
+	"testing"
+)
+
+func createUlaPlus(t *testing.T) *gumak.Gumak {
+	m, _ := gumak.FindMachine("128")
+	m.Peripherals = append(m.Peripherals, gumak.PeripheralUlaPlus)
+
+	g, err := gumak.CreateMachine(m, 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	return g
+}
+
+func TestUlaPlus(t *testing.T) {
+	g := createUlaPlus(t)
+
+	// Entry 1 (ink 1 of CLUT 0), entry 24 (paper 0 of CLUT 1).
+	g.Io.Write(0xbf3b, 1)
+	g.Io.Write(0xff3b, 0b11100000)
+	g.Io.Write(0xbf3b, 24)
+	g.Io.Write(0xff3b, 0b00000011)
+
+	if g.Io.Read(0xff3b) != 0b00000011 {
+		t.Fatalf("Invalid palette readback")
+	}
+
+	// Mode group, palette on.
+	g.Io.Write(0xbf3b, 0b01000000)
+	g.Io.Write(0xff3b, 1)
+	if g.Io.Read(0xff3b) != 1 || !g.Ula.UlaPlus.Enabled() {
+		t.Fatalf("Palette mode not enabled")
+	}
+
+	vram := g.Ram.Bank(device.BANK_VRAM)
+	vram[0] = 0xf0
+	vram[6144] = 0b01000001 // Bright, ink 1, paper 0.
+
+	g.Ula.UpdateEndFrame()
+
+	line := displayLine(g.Ula.Frame, 0)
+	if line[0] != device.SCREEN_ULAPLUS+16+1 || line[7] != device.SCREEN_ULAPLUS+16+8 {
+		t.Fatalf("Invalid ULAplus colour indexes: %v", line[:8])
+	}
+
+	rgba := make([]byte, 4*g.Ula.Frame.Res.W*g.Ula.Frame.Res.H)
+	g.GetFrame(rgba, 4*g.Ula.Frame.Res.W, device.PIXEL_FORMAT_RGBA)
+
+	// Border uses paper colours of CLUT 0, BORDER 0 is entry 8.
+	if c := device.UlaPlusColor(g.Ula.UlaPlus.Palette[8]); rgba[0] != c.R || rgba[1] != c.G || rgba[2] != c.B {
+		t.Fatalf("Invalid border colour")
+	}
+
+	if c := device.UlaPlusColor(0b00000011); c != (device.RGB{R: 0, G: 0, B: 255}) {
+		t.Fatalf("Invalid colour conversion: %v", c)
+	}
+}
+
+func TestUlaPlusSnapshot(t *testing.T) {
+	g := createUlaPlus(t)
+
+	g.Io.Write(0xbf3b, 5)
+	g.Io.Write(0xff3b, 0x55)
+	g.Io.Write(0xbf3b, 0b01000000)
+	g.Io.Write(0xff3b, 1)
+	g.Io.Write(0x7ffd, 0b00011)
+	g.Ram.Write(0xc000, 0xaa)
+	g.Cpu.Reg.PC = 0x1234
+	g.Cpu.Reg.IX = 0x5678
+
+	var buffer bytes.Buffer
+	if err := g.SaveSnapshot("test.szx", &buffer); err != nil {
+		t.Fatalf("Failed to save snapshot: %s", err)
+	}
+
+	loaded := createUlaPlus(t)
+	if err := loaded.LoadSnapshot("test.szx", &buffer); err != nil {
+		t.Fatalf("Failed to load snapshot: %s", err)
+	}
+
+	if loaded.Cpu.Reg.PC != 0x1234 || loaded.Cpu.Reg.IX != 0x5678 {
+		t.Fatalf("Invalid registers")
+	}
+
+	if loaded.Ram.Read(0xc000) != 0xaa || loaded.Ram.Bank(3)[0] != 0xaa {
+		t.Fatalf("Invalid RAM paging")
+	}
+
+	if !loaded.Ula.UlaPlus.Enabled() || loaded.Ula.UlaPlus.Palette[5] != 0x55 {
+		t.Fatalf("Invalid ULAplus state")
+	}
+
+	// Palette is latched without waiting for the end of the frame.
+	if loaded.Ula.Frame.UlaPlus[5] != 0x55 {
+		t.Fatalf("ULAplus palette not applied to the frame")
+	}
+}
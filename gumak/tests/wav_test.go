@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mutex/gumak"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWavExport(t *testing.T) {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "test.wav")
+	if err := g.StartWav(file); err != nil {
+		t.Fatalf("Failed to start WAV export: %s", err)
+	}
+
+	samples := make([]int16, 2*4410)
+	g.ReadAudioInt16(samples, nil)
+
+	if err := g.StopWav(); err != nil {
+		t.Fatalf("Failed to stop WAV export: %s", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file holds exactly the samples read by the host.
+	exported := make([]int16, (len(data)-44)/2)
+	binary.Read(bytes.NewReader(data[44:]), binary.LittleEndian, exported)
+	if len(exported) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(exported))
+	}
+	for i := range samples {
+		if samples[i] != exported[i] {
+			t.Fatalf("Sample %d differs: %d != %d", i, samples[i], exported[i])
+		}
+	}
+}
+
+func TestRenderSnapshotWav(t *testing.T) {
+	g, err := gumak.CreateNew("48", 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	for frame := 0; frame < 100; {
+		if g.Tick() {
+			frame++
+		}
+	}
+
+	// Square wave on the beeper.
+	code := []byte{
+		0x3e, 0x10, // LD A,0x10
+		0xd3, 0xfe, // loop: OUT (0xfe),A
+		0xee, 0x10, // XOR 0x10
+		0x06, 0x64, // LD B,100
+		0x10, 0xfe, // DJNZ $
+		0x18, 0xf6, // JR loop
+	}
+	for i, b := range code {
+		g.Ram.Write(0x8000+uint16(i), b)
+	}
+	g.Cpu.Reg.PC = 0x8000
+
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "beep.z80")
+	if err := g.SaveSnapshot(snapshot, nil); err != nil {
+		t.Fatalf("Failed to save snapshot: %s", err)
+	}
+
+	var renders [][]byte
+	for _, name := range []string{"first.wav", "second.wav"} {
+		file := filepath.Join(dir, name)
+		if err := gumak.RenderSnapshotWav("48", snapshot, file, 0.5, 44100); err != nil {
+			t.Fatalf("Failed to render WAV: %s", err)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renders = append(renders, data)
+	}
+
+	if len(renders[0]) != 44+4*22050 {
+		t.Fatalf("Expected 22050 frames, got %d bytes", len(renders[0]))
+	}
+
+	if !bytes.Equal(renders[0], renders[1]) {
+		t.Fatalf("Renders of the same snapshot differ")
+	}
+
+	// Not silent.
+	low, high := int16(0), int16(0)
+	for i := 44; i+1 < len(renders[0]); i += 2 {
+		v := int16(binary.LittleEndian.Uint16(renders[0][i:]))
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+	if high-low < 1000 {
+		t.Fatalf("Rendered audio is silent (%d..%d)", low, high)
+	}
+}
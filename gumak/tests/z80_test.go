@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"bytes"
+	"mutex/gumak"
+	"testing"
+)
+
+func TestZ80Plus3Snapshot(t *testing.T) {
+	g, err := gumak.CreateMachine(plus3Machine(t), 44100)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %s", err)
+	}
+
+	// ROM 3 by the high bit in 0x1ffd, then special paging 4, 7, 6, 3.
+	g.Io.Write(0x7ffd, 0b10110)
+	g.Io.Write(0x1ffd, 0b100)
+	if g.Ram.Read(0) != 0x13 {
+		t.Fatalf("ROM 3 not selected")
+	}
+	g.Io.Write(0x1ffd, 0b111)
+	g.Ram.Write(0x4000, 0xaa)
+	g.Cpu.Reg.PC = 0x1234
+
+	var buffer bytes.Buffer
+	if err := g.SaveSnapshot("test.z80", &buffer); err != nil {
+		t.Fatalf("Failed to save snapshot: %s", err)
+	}
+	saved := buffer.Bytes()
+	if saved[30] != 55 || saved[34] != 7 || saved[35] != 0b10110 || saved[86] != 0b111 {
+		t.Fatalf("Invalid +3 header")
+	}
+
+	loaded, _ := gumak.CreateMachine(plus3Machine(t), 44100)
+	if err := loaded.LoadSnapshot("test.z80", bytes.NewReader(saved)); err != nil {
+		t.Fatalf("Failed to load snapshot: %s", err)
+	}
+
+	if loaded.Cpu.Reg.PC != 0x1234 || loaded.Ula.Last0x1ffd != 0b111 || loaded.Ula.Last0x7ffd != 0b10110 {
+		t.Fatalf("Invalid registers or ports")
+	}
+	if loaded.Ram.Read(0x4000) != 0xaa || loaded.Ram.Bank(7)[0] != 0xaa {
+		t.Fatalf("Invalid special paging")
+	}
+
+	// ROM high bit after the special paging is turned off.
+	loaded.Io.Write(0x1ffd, 0b100)
+	if loaded.Ram.Read(0) != 0x13 {
+		t.Fatalf("Invalid ROM after load")
+	}
+
+	// Machines without port 0x1ffd refuse the snapshot.
+	g128, _ := gumak.CreateNew("128", 44100)
+	if g128.LoadSnapshot("test.z80", bytes.NewReader(saved)) == nil {
+		t.Fatalf("+3 snapshot loaded into 128K")
+	}
+	g128.Ula.Write1ffd(0b1)
+	if g128.Ula.Last0x1ffd != 0 {
+		t.Fatalf("128K accepts port 0x1ffd")
+	}
+}
@@ -0,0 +1,140 @@
+package gumak
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"mutex/gumak/device"
+	"mutex/gumak/formats"
+	"mutex/gumak/log"
+)
+
+// Export of the mixed audio into WAV, every sample popped from the emulator
+// (PopAudioSample, PopAudioFloat, ReadAudio) is written as 16-bit stereo.
+// The samples depend only on the emulated machine, so the same snapshot
+// rendered at the same rate gives the same file.
+
+type wavExporter struct {
+	file   *os.File // Nil when writing to caller's writer.
+	writer *formats.WavWriter
+	err    error
+}
+
+// StartWav exports the audio from now on into WAV file.
+func (g *Gumak) StartWav(filename string) error {
+	if g.wav != nil {
+		return fmt.Errorf("WAV export already running")
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := g.startWav(file); err != nil {
+		file.Close()
+		return err
+	}
+	g.wav.file = file
+
+	log.Info("Exporting audio to %s", filename)
+	return nil
+}
+
+func (g *Gumak) startWav(writer io.WriteSeeker) error {
+	w, err := formats.NewWavWriter(writer, formats.NewWaveFormat(g.audioFreq, 2, 16))
+	if err != nil {
+		return err
+	}
+
+	g.wav = &wavExporter{writer: w}
+	return nil
+}
+
+// StopWav finishes the export, returns first error that occurred while
+// exporting.
+func (g *Gumak) StopWav() error {
+	if g.wav == nil {
+		return nil
+	}
+
+	w := g.wav
+	g.wav = nil
+
+	if w.err == nil {
+		w.err = w.writer.Close()
+	}
+
+	if w.file != nil {
+		if err := w.file.Close(); w.err == nil {
+			w.err = err
+		}
+	}
+
+	return w.err
+}
+
+func (g *Gumak) WavExporting() bool {
+	return g.wav != nil
+}
+
+// RenderWav runs the emulation for seconds as fast as possible and writes
+// its audio as WAV into writer.
+func (g *Gumak) RenderWav(writer io.WriteSeeker, seconds float64) error {
+	if g.wav != nil {
+		return fmt.Errorf("WAV export already running")
+	}
+
+	if err := g.startWav(writer); err != nil {
+		return err
+	}
+
+	for samples := int(seconds*float64(g.audioFreq) + 0.5); samples > 0; samples-- {
+		for !g.runSample(nil) {
+			g.WaitTapeLoaded()
+		}
+		g.PopAudioFloat()
+	}
+
+	return g.StopWav()
+}
+
+func (w *wavExporter) addSample(left, right float32) {
+	if w.err != nil {
+		return
+	}
+
+	l, r := device.SampleInt16(left), device.SampleInt16(right)
+	_, w.err = w.writer.Write([]byte{uint8(l), uint8(l >> 8), uint8(r), uint8(r >> 8)})
+
+	if w.err != nil {
+		log.Error("WAV export failed: %s", w.err)
+	}
+}
+
+// RenderSnapshotWav renders seconds of audio of the snapshot loaded into
+// fresh machine (see CreateNew) as WAV file, e.g. for audio regression
+// tests against reference recordings.
+func RenderSnapshotWav(model, snapshot, filename string, seconds float64, audioFreq int) error {
+	g, err := CreateNew(model, audioFreq)
+	if err != nil {
+		return err
+	}
+
+	if err := g.LoadSnapshot(snapshot, nil); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = g.RenderWav(file, seconds)
+	if e := file.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
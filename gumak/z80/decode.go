@@ -6,7 +6,7 @@ import (
 )
 
 func DecodeInstruction(cpu *CPU) InstrOp {
-	op := FetchInstruction(cpu)
+	op := FetchOpcode(cpu)
 	return OpCodes[op]
 }
 
@@ -37,6 +37,15 @@ func FetchInstruction(cpu *CPU) uint8 {
 	return inst
 }
 
+// FetchOpcode reads opcode in M1 cycle, 4 T-states of the fetch and the
+// refresh instead of 3 of the other memory reads.
+func FetchOpcode(cpu *CPU) uint8 {
+	cpu.Pin.M1 = true
+	op := FetchInstruction(cpu)
+	cpu.Pin.M1 = false
+	return op
+}
+
 func FetchOperand8(cpu *CPU) uint8 {
 	return FetchInstruction(cpu)
 }
@@ -370,7 +370,7 @@ func init() {
 	OpCodes[0xdc] = /* call c,nn */ func(cpu *CPU) int { return CALL_FLAG_nn(cpu, FLAG_CARRY, true) }
 
 	OpCodes[0xdd] = func(cpu *CPU) int {
-		op := FetchInstruction(cpu)
+		op := FetchOpcode(cpu)
 		return OpCodes_IX_IY[op](cpu, &cpu.Reg.IX)
 	}
 
@@ -407,7 +407,7 @@ func init() {
 	OpCodes[0xec] = /* call pe,nn */ func(cpu *CPU) int { return CALL_FLAG_nn(cpu, FLAG_PARTY_OVERFLOW, false) }
 
 	OpCodes[0xed] = func(cpu *CPU) int {
-		op := FetchInstruction(cpu)
+		op := FetchOpcode(cpu)
 		return OpCodes_ED[op](cpu)
 	}
 
@@ -445,7 +445,7 @@ func init() {
 	OpCodes[0xfc] = /* call m,nn 	*/ func(cpu *CPU) int { return CALL_FLAG_nn(cpu, FLAG_SIGN, true) }
 
 	OpCodes[0xfd] = func(cpu *CPU) int {
-		op := FetchInstruction(cpu)
+		op := FetchOpcode(cpu)
 		return OpCodes_IX_IY[op](cpu, &cpu.Reg.IY)
 	}
 
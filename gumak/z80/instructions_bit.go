@@ -33,7 +33,7 @@ func resetBit6(cpu *CPU, ans uint8) uint8 { return Alu_RES(cpu, ans, 6) }
 func resetBit7(cpu *CPU, ans uint8) uint8 { return Alu_RES(cpu, ans, 7) }
 
 func Instr_0xCB(cpu *CPU) int {
-	op2 := FetchInstruction(cpu)
+	op2 := FetchOpcode(cpu)
 	r := op2 & 0b00000111
 
 	test := op2 >= 64 && op2 < 128
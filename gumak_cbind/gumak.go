@@ -57,9 +57,15 @@ import (
 
 type Instance struct {
 	gumak *gumak.Gumak
+
+	// Double buffered 8-bit mono audio, see GumakAudioBuffer.
+	buffers [2][]byte
+	buffer  int // Buffer being filled.
+	pos     int
+	ready   bool
 }
 
-var instances = map[int]Instance{}
+var instances = map[int]*Instance{}
 var instanceId int
 
 func WCharPtrToString(p *C.wchar_t) string {
@@ -73,14 +79,44 @@ func GumakResolution() (iw, ih, ow, oh int) {
 	return
 }
 
+//export GumakMachineCount
+func GumakMachineCount() int {
+	return len(gumak.Machines())
+}
+
+// Copies zero terminated name of the machine into the buffer, returns length
+// of the name.
+//
+//export GumakMachineName
+func GumakMachineName(index int, buffer *C.char, length int) int {
+	machines := gumak.Machines()
+	if index < 0 || index >= len(machines) || length <= 0 {
+		return 0
+	}
+
+	out := unsafe.Slice((*byte)(unsafe.Pointer(buffer)), length)
+	n := copy(out[:length-1], machines[index].Name)
+	out[n] = 0
+
+	return n
+}
+
+// Creates machine, ROMs are loaded from romPath when not empty (embedded
+// ROMs otherwise).
+//
 //export GumakCreate
-func GumakCreate(is48K bool, freq, samples int, romPath string) int {
-	fmt.Printf("Loading roms from '%s'", romPath)
+func GumakCreate(model string, freq int, romPath string) int {
+	m, ok := gumak.FindMachine(model)
+	if !ok {
+		fmt.Printf("Error 'Unknown machine: %s'", model)
+		return 0
+	}
+	m.RomDir = romPath
 
-	var inst Instance
+	inst := new(Instance)
 	var err error
 
-	inst.gumak, err = gumak.CreateNew(is48K, freq, samples, romPath)
+	inst.gumak, err = gumak.CreateMachine(m, freq)
 	if err != nil {
 		fmt.Printf("Error '%s'", err)
 		return 0
@@ -92,8 +128,8 @@ func GumakCreate(is48K bool, freq, samples int, romPath string) int {
 }
 
 //export GumakCreateWChar
-func GumakCreateWChar(is48K bool, freq, samples int, p *C.wchar_t) int {
-	return GumakCreate(is48K, freq, samples, WCharPtrToString(p))
+func GumakCreateWChar(model *C.wchar_t, freq int, p *C.wchar_t) int {
+	return GumakCreate(WCharPtrToString(model), freq, WCharPtrToString(p))
 }
 
 //export GumakDestroy
@@ -101,24 +137,53 @@ func GumakDestroy(id int) {
 	delete(instances, id)
 }
 
+// Runs emulation of one frame and fills the audio buffers with its samples.
+// During fast tape loading returns without emulating.
+//
 //export GumakUpdateFrame
 func GumakUpdateFrame(id int) bool {
-	return instances[id].gumak.Update()
+	inst := instances[id]
+	g := inst.gumak
+
+	for {
+		frame := g.Tick()
+		if g.AudioSampleReady() {
+			inst.pushSample(g.PopAudioSample())
+		}
+		if frame {
+			return true
+		}
+	}
+}
+
+func (inst *Instance) pushSample(sample uint8) {
+	buffer := inst.buffers[inst.buffer]
+	if len(buffer) == 0 {
+		return
+	}
+
+	buffer[inst.pos] = sample
+	inst.pos++
+	if inst.pos == len(buffer) {
+		inst.buffer ^= 1
+		inst.pos = 0
+		inst.ready = true
+	}
 }
 
 //export GumakReset
 func GumakReset(id int) {
-	instances[id].gumak.Restart()
+	instances[id].gumak.Reset()
 }
 
 //export GumakDisplayDataRGB
 func GumakDisplayDataRGB(id int, data []byte, pitch int) {
-	instances[id].gumak.GetDisplayDataRGB(data, pitch)
+	instances[id].gumak.GetDisplayDataRGBFrame(data, pitch)
 }
 
 //export GumakDisplayDataBGR
 func GumakDisplayDataBGR(id int, data []byte, pitch int) {
-	instances[id].gumak.GetDisplayDataBGR(data, pitch)
+	instances[id].gumak.GetDisplayDataBGRFrame(data, pitch)
 }
 
 //export GumakBackgroundColor
@@ -134,7 +199,7 @@ func GumakHandleKey(id int, key int, down bool) {
 
 //export GumakLoadSnapshot
 func GumakLoadSnapshot(id int, file string) bool {
-	err := instances[id].gumak.LoadSnapshot(file)
+	err := instances[id].gumak.LoadSnapshot(file, nil)
 	if err != nil {
 		fmt.Printf("Error loading snapshot: %s", err)
 		return false
@@ -171,16 +236,25 @@ func GumakFirstActiveInstance() int {
 	return 0
 }
 
+// Sets one of the two audio buffers (bufferId 0 or 1) the emulated 8-bit mono
+// samples are written into, the buffers are filled in turns.
+//
 //export GumakAudioBuffer
 func GumakAudioBuffer(id int, bufferId int, buffer unsafe.Pointer, length int) {
-	b := unsafe.Slice((*uint8)(buffer), length)
-
-	instances[id].gumak.SetAudioBuffer(bufferId, b)
+	inst := instances[id]
+	inst.buffers[bufferId&1] = unsafe.Slice((*uint8)(buffer), length)
+	inst.buffer, inst.pos = 0, 0
 }
 
+// Reports once that a buffer was filled since the last call, the filled
+// buffer is the one not being written.
+//
 //export GumakAudioReady
 func GumakAudioReady(id int) bool {
-	return instances[id].gumak.AudioReady()
+	inst := instances[id]
+	ready := inst.ready
+	inst.ready = false
+	return ready
 }
 
 func main() {}
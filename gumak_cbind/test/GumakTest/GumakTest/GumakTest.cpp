@@ -72,7 +72,17 @@ int main()
 	romPath.p = "..\\..\\gumak\\roms";
 	romPath.n = strlen(romPath.p);
 
-	const auto inst{ GumakCreate(0, 48000, 1024, romPath) };
+	for (int i{}; i < GumakMachineCount(); ++i) {
+		char name[32];
+		GumakMachineName(i, name, sizeof(name));
+		std::cout << "Machine: " << name << "\n";
+	}
+
+	GoString model{};
+	model.p = "128";
+	model.n = strlen(model.p);
+
+	const auto inst{ GumakCreate(model, 48000, romPath) };
 	if (inst == 0) {
 		std::cerr << "Failed to create instance\n";
 		return 0;
@@ -0,0 +1,7 @@
+module mutex/gumak_cli
+
+go 1.17
+
+require mutex/gumak v0.0.0-00010101000000-000000000000
+
+replace mutex/gumak => ../gumak
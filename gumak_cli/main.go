@@ -0,0 +1,257 @@
+// Headless front-end, runs the emulation without window and sound as fast
+// as possible and captures its output (GIF, video, WAV, screenshot). With
+// -play it renders AY music file (.ay, .psg, .ym) into WAV.
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"mutex/gumak"
+	"mutex/gumak/formats"
+	"mutex/gumak/log"
+	"mutex/gumak/player"
+	"os"
+)
+
+var (
+	machine      = flag.String("machine", "128", "machine (see -machines)")
+	listMachines = flag.Bool("machines", false, "list available machines")
+	ulaPlus      = flag.Bool("ulaplus", false, "attach ULAplus 64 colour palette")
+	timex        = flag.Bool("timex", false, "attach Timex screen modes (port 0xff)")
+	palette      = flag.String("palette", "default", "palette preset or file with 16 colours")
+	border       = flag.String("border", "normal", "border size (normal=320x240, full=352x296)")
+	snapshot     = flag.String("snapshot", "", "snapshot to load on startup")
+	tape         = flag.String("tape", "", "tape to play on startup")
+	fastTape     = flag.Bool("fasttape", true, "load tapes at full speed without sound")
+	skip         = flag.Float64("skip", 0, "seconds to run before the capture")
+	seconds      = flag.Float64("seconds", 10, "seconds to run (capture length)")
+	panning      = flag.String("panning", "mono", "AY channel panning (mono, abc, acb, bac or custom a,b,c)")
+	freq         = flag.Int("freq", 44100, "audio sample rate")
+	gif          = flag.String("gif", "", "capture animated GIF")
+	gifBorder    = flag.Bool("gifborder", true, "include border in the GIF")
+	record       = flag.String("record", "", "record video (.avi, or .y4m with .wav audio)")
+	ayLog        = flag.String("aylog", "", "log AY registers (.psg or .ym)")
+	ym5          = flag.Bool("ym5", false, "write .ym AY log as YM5 instead of YM6")
+	screenshot   = flag.String("screenshot", "", "save PNG screenshot at the end")
+	play         = flag.String("play", "", "play AY music file (.ay, .psg, .ym) into -wav")
+	song         = flag.Int("song", 0, "song of the AY music file (from 1, default first)")
+	wav          = flag.String("wav", "", "export audio into WAV (or render -play)")
+)
+
+func main() {
+	flag.Parse()
+
+	if *listMachines {
+		for _, m := range gumak.Machines() {
+			fmt.Printf("%-10s %s\n", m.Name, m.Description)
+		}
+		return
+	}
+
+	var err error
+	if len(*play) > 0 {
+		err = runPlayer()
+	} else {
+		err = run()
+	}
+
+	if err != nil {
+		log.Error("%s", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	model, ok := gumak.FindMachine(*machine)
+	if !ok {
+		return fmt.Errorf("Unknown machine: %s", *machine)
+	}
+
+	if *ulaPlus {
+		model.Peripherals = append(model.Peripherals, gumak.PeripheralUlaPlus)
+	}
+
+	if *timex {
+		model.Peripherals = append(model.Peripherals, gumak.PeripheralTimex)
+	}
+
+	g, err := gumak.CreateMachine(model, *freq)
+	if err != nil {
+		return err
+	}
+
+	switch *border {
+	case "normal":
+	case "full":
+		if err := g.SetFrameResolution(352, 296); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown border size: %s", *border)
+	}
+
+	if err := g.Mixer.ParsePanning(*panning); err != nil {
+		return err
+	}
+
+	if err := g.SetPalette(*palette); err != nil {
+		if err := g.LoadPalette(*palette); err != nil {
+			return err
+		}
+	}
+
+	if len(*snapshot) > 0 {
+		if err := g.LoadSnapshot(*snapshot, nil); err != nil {
+			return err
+		}
+	}
+
+	g.FastTape = *fastTape
+	if len(*tape) > 0 {
+		if err := g.PlayTape(*tape); err != nil {
+			return err
+		}
+	}
+
+	runFrames(g, int(*skip*g.FrameRate()+0.5))
+
+	if len(*gif) > 0 {
+		if err := g.StartGif(*gif, *seconds, *gifBorder); err != nil {
+			return err
+		}
+	}
+
+	if len(*record) > 0 {
+		if err := g.StartRecording(*record); err != nil {
+			return err
+		}
+	}
+
+	frames := int(*seconds*g.FrameRate() + 0.5)
+	if len(*ayLog) > 0 {
+		format, err := gumak.AyLogFormatOf(*ayLog)
+		if err != nil {
+			return err
+		}
+		if format == gumak.AyLogYm6 && *ym5 {
+			format = gumak.AyLogYm5
+		}
+
+		if err := g.StartAyLog(*ayLog, format, frames); err != nil {
+			return err
+		}
+	}
+
+	if len(*wav) > 0 {
+		if err := g.StartWav(*wav); err != nil {
+			return err
+		}
+	}
+
+	runFrames(g, frames)
+
+	if err := g.StopWav(); err != nil {
+		return err
+	}
+
+	if err := g.StopGif(); err != nil {
+		return err
+	}
+
+	if err := g.StopRecording(); err != nil {
+		return err
+	}
+
+	if err := g.StopAyLog(); err != nil {
+		return err
+	}
+
+	if len(*screenshot) > 0 {
+		return g.SaveScreenshot(*screenshot, nil)
+	}
+
+	return nil
+}
+
+// Runs frames of emulation, audio samples are consumed as by a sound card.
+// Fast tape loading is not counted, the machine is not touched until it
+// finishes.
+func runFrames(g *gumak.Gumak, frames int) {
+	for frames > 0 {
+		for !g.AudioSampleReady() {
+			frame := g.Tick()
+			if g.WaitTapeLoaded() {
+				continue
+			}
+			if frame {
+				frames--
+			}
+		}
+		g.PopAudioSample()
+	}
+}
+
+// Renders song of the music file into WAV, the whole song (or default
+// length when unknown) unless -seconds is given.
+func runPlayer() error {
+	if len(*wav) == 0 {
+		return fmt.Errorf("Missing -wav output of -play")
+	}
+
+	p, err := player.Open(*play, *freq)
+	if err != nil {
+		return err
+	}
+
+	if *song > 0 {
+		if err := p.SelectSong(*song - 1); err != nil {
+			return err
+		}
+	}
+
+	if err := p.Mixer.ParsePanning(*panning); err != nil {
+		return err
+	}
+
+	length := p.Length()
+	if length == 0 {
+		length = player.DEFAULT_SECONDS
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seconds" {
+			length = *seconds
+		}
+	})
+
+	log.Info("Playing %d/%d '%s' by '%s', %.1f s", p.Song()+1, p.Songs(), p.SongName(), p.Author, length)
+
+	file, err := os.Create(*wav)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := formats.NewWavWriter(file, formats.NewWaveFormat(*freq, 2, 16))
+	if err != nil {
+		return err
+	}
+
+	samples := make([]int16, 2*(*freq/10))
+	data := make([]byte, 2*len(samples))
+	for frames := int(length * float64(*freq)); frames > 0; frames -= len(samples) / 2 {
+		if frames < len(samples)/2 {
+			samples = samples[:2*frames]
+		}
+		p.ReadAudioInt16(samples, nil)
+
+		for i, sample := range samples {
+			binary.LittleEndian.PutUint16(data[2*i:], uint16(sample))
+		}
+		if _, err := w.Write(data[:2*len(samples)]); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
@@ -9,6 +9,7 @@ import "C"
 import (
 	"fmt"
 	"mutex/gumak"
+	"mutex/gumak/device"
 	"mutex/gumak/helpers"
 	"path"
 	"strconv"
@@ -54,7 +55,7 @@ type Gfx struct {
 	font     *ttf.Font
 	fontSize int32
 
-	vramCopy     []byte
+	frame        *device.Screen // Last finished frame.
 	unscaledData []byte
 
 	upscale float64
@@ -102,7 +103,7 @@ func (g *Gfx) updateTexture(gumak *gumak.Gumak) {
 	if err != nil {
 		panic("Failed to create surface")
 	}
-	gumak.GetDisplayDataBGR(data, g.vramCopy, pitch)
+	gumak.GetDisplayDataBGR(data, g.frame, pitch)
 	g.texture.Unlock()
 }
 
@@ -112,9 +113,7 @@ func (g *Gfx) Init(filtering Filtering, innerWidth, innerHeight, outerWidth, out
 	g.uTime = 0
 	g.start = time.Now()
 	g.soundMutex = mutex
-	g.vramCopy = make([]byte, 6912) // TODO: Cleanup.
-
-	g.innerWidth, g.innerHeight = innerWidth, innerHeight
+	g.frame = device.NewScreen(device.Resolution{W: innerWidth, H: innerHeight})
 
 	g.hq = 0
 	sdlFiltering := 0
@@ -131,16 +130,6 @@ func (g *Gfx) Init(filtering Filtering, innerWidth, innerHeight, outerWidth, out
 		g.hq = 2
 	}
 
-	textureWidth, textureHeight := int32(innerWidth), int32(innerHeight)
-	switch g.hq {
-	case 1:
-		textureWidth *= 2
-		textureHeight *= 2
-	case 2:
-		textureWidth *= 3
-		textureHeight *= 3
-	}
-
 	winWidth := g.upscale * float64(outerWidth)
 	winHeight := g.upscale * float64(outerHeight)
 
@@ -150,8 +139,6 @@ func (g *Gfx) Init(filtering Filtering, innerWidth, innerHeight, outerWidth, out
 	y := int32((winHeight - float64(h)) / 2.0)
 	g.displayTargetRect = sdl.Rect{x, y, w, h}
 
-	g.textureRect = sdl.Rect{0, 0, textureWidth, textureHeight}
-
 	renderer, err := sdl.CreateRenderer(g.win, -1, sdl.RENDERER_ACCELERATED|sdl.RENDERER_TARGETTEXTURE)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to create renderer: %s\n", err))
@@ -161,17 +148,8 @@ func (g *Gfx) Init(filtering Filtering, innerWidth, innerHeight, outerWidth, out
 		panic(fmt.Sprintf("Failed to set filtering: %s\n", err))
 	}
 
-	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_RGB888, sdl.TEXTUREACCESS_STREAMING, textureWidth, textureHeight)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create texture: %s\n", err))
-	}
-
 	g.renderer = renderer
-	g.texture = texture
-
-	if g.hq > 0 {
-		g.unscaledData = make([]byte, innerWidth*innerHeight*4)
-	}
+	g.createTexture(innerWidth, innerHeight)
 
 	g.fontSize = int32(g.upscale * 11.)
 	if g.fontSize > 24 {
@@ -186,6 +164,39 @@ func (g *Gfx) Init(filtering Filtering, innerWidth, innerHeight, outerWidth, out
 	g.createHelpWin(int32(winWidth), int32(winHeight))
 }
 
+// Creates texture for frames of given resolution, the frame is always
+// stretched to the display rectangle (Timex hi-res has double width).
+func (g *Gfx) createTexture(width, height int) {
+	if g.texture != nil {
+		g.texture.Destroy()
+	}
+
+	g.innerWidth, g.innerHeight = width, height
+
+	textureWidth, textureHeight := int32(width), int32(height)
+	switch g.hq {
+	case 1:
+		textureWidth *= 2
+		textureHeight *= 2
+	case 2:
+		textureWidth *= 3
+		textureHeight *= 3
+	}
+
+	g.textureRect = sdl.Rect{0, 0, textureWidth, textureHeight}
+
+	texture, err := g.renderer.CreateTexture(sdl.PIXELFORMAT_RGB888, sdl.TEXTUREACCESS_STREAMING, textureWidth, textureHeight)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to create texture: %s\n", err))
+	}
+
+	g.texture = texture
+
+	if g.hq > 0 {
+		g.unscaledData = make([]byte, width*height*4)
+	}
+}
+
 func (g *Gfx) Destroy() {
 	ttf.Quit()
 	g.texture.Destroy()
@@ -236,11 +247,18 @@ func (g *Gfx) createHelpWin(w int32, h int32) {
 	g.renderText("F2  - Insert & play tape", sdl.Color{255, 0, 0, 255}, leftCol, top+g.fontSize)
 	g.renderText("F4  - Reset", sdl.Color{255, 0, 0, 255}, leftCol, top+2*g.fontSize)
 	g.renderText("F7  - Toggle audio", sdl.Color{255, 0, 0, 255}, leftCol, top+3*g.fontSize)
+	g.renderText("F6  - Next palette", sdl.Color{255, 0, 0, 255}, leftCol, top+4*g.fontSize)
+	g.renderText("F3  - Screenshot (PNG)", sdl.Color{255, 0, 0, 255}, leftCol, top+5*g.fontSize)
+	g.renderText("Pause - Record GIF", sdl.Color{255, 0, 0, 255}, leftCol, top+6*g.fontSize)
+	g.renderText("ScrLk - Log AY music", sdl.Color{255, 0, 0, 255}, leftCol, top+7*g.fontSize)
+	g.renderText("Ins - Export audio (WAV)", sdl.Color{255, 0, 0, 255}, leftCol, top+8*g.fontSize)
 
 	g.renderText("F5  - Quicksave", sdl.Color{255, 255, 0, 255}, rightCol, top)
 	g.renderText("F9  - Quickload", sdl.Color{255, 255, 0, 255}, rightCol, top+g.fontSize)
 	g.renderText("F11 - Load snapshot", sdl.Color{255, 0, 255, 255}, rightCol, top+2*g.fontSize)
 	g.renderText("F12 - Save snapshot", sdl.Color{255, 0, 255, 255}, rightCol, top+3*g.fontSize)
+	g.renderText("F8  - Load screen", sdl.Color{255, 0, 255, 255}, rightCol, top+4*g.fontSize)
+	g.renderText("F10 - Save screen", sdl.Color{255, 0, 255, 255}, rightCol, top+5*g.fontSize)
 
 	g.renderer.SetRenderTarget(nil)
 }
@@ -249,13 +267,17 @@ func (g *Gfx) updateFrame(gumak *gumak.Gumak) {
 	g.soundMutex.Lock()
 	defer g.soundMutex.Unlock()
 
+	if g.frame.Res.W != g.innerWidth || g.frame.Res.H != g.innerHeight {
+		g.createTexture(g.frame.Res.W, g.frame.Res.H)
+	}
+
 	switch g.hq {
 	case 0:
 		g.updateTexture(gumak)
 	case 1:
-		gumak.GetDisplayDataBGR(g.unscaledData, g.vramCopy, int(4*g.innerWidth))
+		gumak.GetDisplayDataBGR(g.unscaledData, g.frame, int(4*g.innerWidth))
 	case 2:
-		gumak.GetDisplayDataBGR(g.unscaledData, g.vramCopy, int(4*g.innerWidth))
+		gumak.GetDisplayDataBGR(g.unscaledData, g.frame, int(4*g.innerWidth))
 	}
 }
 
@@ -277,12 +299,7 @@ func (g *Gfx) Draw(gumak *gumak.Gumak) {
 	// Clear.
 	g.renderer.Clear()
 
-	// Border.
-	bgR, bgG, bgB := gumak.GetBackgroundColor()
-	g.renderer.SetDrawColor(bgR, bgG, bgB, 255)
-	g.renderer.FillRect(&g.displayTargetRect)
-
-	// Screen.
+	// Screen including the border.
 	g.renderer.Copy(g.texture, &g.textureRect, &g.displayTargetRect)
 
 	// Help window.
@@ -72,4 +72,24 @@ var KeyMap = map[sdl.Keycode][]gumak.Key{
 	sdl.K_LEFTBRACKET:  []gumak.Key{gumak.KeySymbolShift, gumak.Key8},
 	sdl.K_RIGHTBRACKET: []gumak.Key{gumak.KeySymbolShift, gumak.Key9},
 	sdl.K_SEMICOLON:    []gumak.Key{gumak.KeySymbolShift, gumak.KeyO},
+
+	// Keypad digits, Kempston joystick when attached (see JoystickMap).
+	sdl.K_KP_0: []gumak.Key{gumak.Key0},
+	sdl.K_KP_1: []gumak.Key{gumak.Key1},
+	sdl.K_KP_2: []gumak.Key{gumak.Key2},
+	sdl.K_KP_3: []gumak.Key{gumak.Key3},
+	sdl.K_KP_4: []gumak.Key{gumak.Key4},
+	sdl.K_KP_5: []gumak.Key{gumak.Key5},
+	sdl.K_KP_6: []gumak.Key{gumak.Key6},
+	sdl.K_KP_7: []gumak.Key{gumak.Key7},
+	sdl.K_KP_8: []gumak.Key{gumak.Key8},
+	sdl.K_KP_9: []gumak.Key{gumak.Key9},
+}
+
+var JoystickMap = map[sdl.Keycode]gumak.JoystickButton{
+	sdl.K_KP_8: gumak.JoystickUp,
+	sdl.K_KP_2: gumak.JoystickDown,
+	sdl.K_KP_4: gumak.JoystickLeft,
+	sdl.K_KP_6: gumak.JoystickRight,
+	sdl.K_KP_0: gumak.JoystickFire,
 }
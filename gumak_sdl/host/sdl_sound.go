@@ -9,69 +9,74 @@ import (
 	"sync"
 	"unsafe"
 
-	"mutex/gumak"
 	"mutex/gumak/log"
 
 	"github.com/veandco/go-sdl2/sdl"
 )
 
+// AudioSource produces interleaved stereo frames, the emulator or the AY
+// music player.
+type AudioSource interface {
+	ReadAudio(buffer []float32, frameReady func())
+	ReadAudioInt16(buffer []int16, frameReady func())
+}
+
 type Sound struct {
-	gumak      *gumak.Gumak
+	source     AudioSource
 	isOn       bool
 	soundMutex *sync.Mutex
-	frameReady *chan bool
-	vram       []byte
+	frameReady func()
+	format     SampleFormat
 }
 
 var sound *Sound
 
-var soundTime float64
-
 //export BeeperCB
 func BeeperCB(userdata unsafe.Pointer, stream *C.Uint8, length C.int) {
-	n := int(length)
-	hdr := reflect.SliceHeader{Data: uintptr(unsafe.Pointer(stream)), Len: n, Cap: n}
-	buf := *(*[]C.Uint8)(unsafe.Pointer(&hdr))
-
 	sound.soundMutex.Lock()
 	defer sound.soundMutex.Unlock()
 
-	for i := 0; i < n; i++ {
-		for !sound.gumak.AudioSampleReady() {
-			if sound.gumak.Tick() {
-				sound.gumak.CopyVRam(sound.vram)
-
-				select {
-				case *sound.frameReady <- true:
-				default:
-				}
-			}
-		}
-
-		buf[i] = C.Uint8(sound.gumak.PopAudioSample())
-
-		/*
-				buf[i] = C.Uint8(32 * (0.5 + 0.5*math.Sin(soundTime*440*2*math.Pi)))
-
-			soundTime += 1. / 44100.
-		*/
+	// Interleaved stereo frames.
+	switch sound.format {
+	case SampleFloat32:
+		n := int(length) / 4
+		hdr := reflect.SliceHeader{Data: uintptr(unsafe.Pointer(stream)), Len: n, Cap: n}
+		sound.source.ReadAudio(*(*[]float32)(unsafe.Pointer(&hdr)), sound.frameReady)
+
+	case SampleInt16:
+		n := int(length) / 2
+		hdr := reflect.SliceHeader{Data: uintptr(unsafe.Pointer(stream)), Len: n, Cap: n}
+		sound.source.ReadAudioInt16(*(*[]int16)(unsafe.Pointer(&hdr)), sound.frameReady)
 	}
 }
 
-// Sound
-func (s *Sound) Init(g *gumak.Gumak, freq int, samples int, mutex *sync.Mutex, frameReady *chan bool, vram []byte) {
-	s.gumak = g
+type SampleFormat int
+
+const (
+	SampleFloat32 = SampleFormat(0)
+	SampleInt16   = SampleFormat(1)
+)
+
+// Sound, the callback reads source under the mutex and calls frameReady
+// (optional) at the end of each frame.
+func (s *Sound) Init(source AudioSource, freq int, samples int, format SampleFormat, mutex *sync.Mutex, frameReady func()) {
+	s.source = source
+	s.format = format
 	s.isOn = true
 	s.soundMutex = mutex
 	s.frameReady = frameReady
-	s.vram = vram
 
 	sound = s
 
+	sdlFormat := sdl.AudioFormat(sdl.AUDIO_F32SYS)
+	if format == SampleInt16 {
+		sdlFormat = sdl.AUDIO_S16SYS
+	}
+
 	spec := &sdl.AudioSpec{
 		Freq:     int32(freq),
-		Format:   sdl.AUDIO_U8,
-		Channels: 1,
+		Format:   sdlFormat,
+		Channels: 2,
 		Samples:  uint16(samples),
 		Callback: sdl.AudioCallback(C.BeeperCB),
 	}
@@ -4,6 +4,7 @@ import (
 	"mutex/gumak"
 	"mutex/gumak/log"
 	"sync"
+	"time"
 
 	"github.com/sqweek/dialog"
 	"github.com/veandco/go-sdl2/sdl"
@@ -18,8 +19,20 @@ type Platform struct {
 
 	gfx *Gfx
 	snd *Sound
+
+	// Animated GIF capture started by the Pause key.
+	GifSeconds float64
+	GifBorder  bool
+
+	// Format of AY log toggled by the Scroll Lock key.
+	AyLogFormat gumak.AyLogFormat
+
+	// Selected palette preset or file, F6 cycles the presets from it.
+	Palette string
 }
 
+var palettes = gumak.Palettes()
+
 // Pixel platform
 func createWin(width, height int) *sdl.Window {
 	w, h := int32(width), int32(height)
@@ -61,9 +74,19 @@ func (h *Platform) CreateGfx(filtering Filtering, iw, ih, ow, oh int) *Gfx {
 	return gfx
 }
 
-func (h *Platform) CreateSound(gumak *gumak.Gumak, freq int, samples int) *Sound {
+func (h *Platform) CreateSound(gumak *gumak.Gumak, freq int, samples int, format SampleFormat) *Sound {
+	frame := h.gfx.frame
+	frameReady := func() {
+		gumak.CopyFrame(frame)
+
+		select {
+		case h.frameReady <- true:
+		default:
+		}
+	}
+
 	sound := new(Sound)
-	sound.Init(gumak, freq, samples, &h.soundGraphicsMutex, &h.frameReady, h.gfx.vramCopy)
+	sound.Init(gumak, freq, samples, format, &h.soundGraphicsMutex, frameReady)
 	h.snd = sound
 
 	return sound
@@ -92,20 +115,97 @@ func (h *Platform) handleEvents(key sdl.Keycode, gumak *gumak.Gumak) {
 			}
 		}
 
+	case sdl.K_F3:
+		file := "screenshot" + gumak.Model + "-" + time.Now().Format("20060102-150405") + ".png"
+		log.Info("Screenshot: %s", file)
+		if err := gumak.SaveScreenshot(file, nil); err != nil {
+			dialog.Message("Error saving screenshot: %s", err)
+		}
+
 	case sdl.K_F4:
 		gumak.Reset()
 
+	case sdl.K_PAUSE:
+		if gumak.GifRecording() {
+			if err := gumak.StopGif(); err != nil {
+				dialog.Message("Error saving GIF: %s", err)
+			}
+			break
+		}
+
+		// Clear the previous capture, its errors are logged.
+		gumak.StopGif()
+		file := "capture" + gumak.Model + "-" + time.Now().Format("20060102-150405") + ".gif"
+		if err := gumak.StartGif(file, h.GifSeconds, h.GifBorder); err != nil {
+			dialog.Message("Error recording GIF: %s", err)
+		}
+
+	case sdl.K_SCROLLLOCK:
+		if gumak.AyLogging() {
+			if err := gumak.StopAyLog(); err != nil {
+				dialog.Message("Error saving AY log: %s", err)
+			}
+			break
+		}
+
+		file := "aylog" + gumak.Model + "-" + time.Now().Format("20060102-150405") + h.AyLogFormat.Extension()
+		if err := gumak.StartAyLog(file, h.AyLogFormat, 0); err != nil {
+			dialog.Message("Error logging AY: %s", err)
+		}
+
+	case sdl.K_INSERT:
+		if gumak.WavExporting() {
+			if err := gumak.StopWav(); err != nil {
+				dialog.Message("Error saving WAV: %s", err)
+			}
+			break
+		}
+
+		file := "audio" + gumak.Model + "-" + time.Now().Format("20060102-150405") + ".wav"
+		if err := gumak.StartWav(file); err != nil {
+			dialog.Message("Error exporting WAV: %s", err)
+		}
+
 	case sdl.K_F5:
 		gumak.SaveSnapshot("quicksave"+gumak.Model+".z80", nil)
 
+	case sdl.K_F6:
+		next := 0
+		for i, name := range palettes {
+			if name == h.Palette {
+				next = (i + 1) % len(palettes)
+			}
+		}
+		h.Palette = palettes[next]
+		log.Info("Palette: %s", h.Palette)
+		gumak.SetPalette(h.Palette)
+
 	case sdl.K_F7:
 		h.snd.TurnOnOff(!h.snd.IsOn())
 
+	case sdl.K_F8:
+		file, err := dialog.File().Filter("Screen", "scr").Load()
+		if err == nil {
+			err = gumak.LoadScreen(file, nil)
+			if err != nil {
+				dialog.Message("Error loading screen: %s", err)
+			}
+		}
+
 	case sdl.K_F9:
 		gumak.LoadSnapshot("quicksave"+gumak.Model+".z80", nil)
 
+	case sdl.K_F10:
+		file, err := dialog.File().Filter("Screen", "scr").Save()
+		if err == nil {
+			err = gumak.SaveScreen(file, nil)
+			if err != nil {
+				dialog.Message("Error saving screen: %s", err)
+			}
+		}
+
 	case sdl.K_F11:
-		file, err := dialog.File().Filter("Snapshot", "sna", "z80").Load()
+		file, err := dialog.File().Filter("Snapshot", "sna", "z80", "szx").Load()
 		if err == nil {
 			err = gumak.LoadSnapshot(file, nil)
 			if err != nil {
@@ -115,7 +215,7 @@ func (h *Platform) handleEvents(key sdl.Keycode, gumak *gumak.Gumak) {
 		}
 
 	case sdl.K_F12:
-		file, err := dialog.File().Filter("Snapshot", "sna", "z80").Save()
+		file, err := dialog.File().Filter("Snapshot", "sna", "z80", "szx").Save()
 		if err == nil {
 			err = gumak.SaveSnapshot(file, nil)
 			if err != nil {
@@ -134,6 +234,12 @@ func (h *Platform) Update(gumak *gumak.Gumak) {
 		case *sdl.QuitEvent:
 			h.closed = true
 		case *sdl.KeyboardEvent:
+			// Keypad is the keyboard without Kempston interface.
+			if button, ok := JoystickMap[e.Keysym.Sym]; ok && gumak.Kempston.Attached {
+				gumak.HandleJoystick(button, e.Type == sdl.KEYDOWN)
+				continue
+			}
+
 			keys, ok := KeyMap[e.Keysym.Sym]
 			if ok {
 				for _, k := range keys {
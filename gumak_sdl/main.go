@@ -2,25 +2,186 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"mutex/gumak"
+	"mutex/gumak/device"
 	"mutex/gumak/log"
+	"mutex/gumak/player"
 	"mutex/gumak_sdl/host"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Custom ROM images in form slot=path[@crc32], flag can be repeated.
+type romFiles []string
+
+func (r *romFiles) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *romFiles) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+func readRomFile(value string) (gumak.RomImage, error) {
+	eq := strings.Index(value, "=")
+	if eq < 0 {
+		return gumak.RomImage{}, fmt.Errorf("Invalid ROM '%s', expected slot=path[@crc32]", value)
+	}
+	slot, file := value[:eq], value[eq+1:]
+
+	index, err := strconv.Atoi(slot)
+	if err != nil {
+		return gumak.RomImage{}, fmt.Errorf("Invalid ROM slot '%s'", slot)
+	}
+
+	var checksum uint64
+	if at := strings.LastIndex(file, "@"); at >= 0 {
+		checksum, err = strconv.ParseUint(file[at+1:], 16, 32)
+		if err != nil {
+			return gumak.RomImage{}, fmt.Errorf("Invalid ROM checksum '%s'", file[at+1:])
+		}
+		file = file[:at]
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return gumak.RomImage{}, err
+	}
+
+	return gumak.RomImage{Slot: index, Data: data, Checksum: uint32(checksum)}, nil
+}
+
+var mixerSources = map[string]int{
+	"beeper": device.MIXER_BEEPER,
+	"a":      device.MIXER_AY_A,
+	"b":      device.MIXER_AY_B,
+	"c":      device.MIXER_AY_C,
+	"tape":   device.MIXER_TAPE,
+}
+
+func muteSources(mixer *device.Mixer, list string) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	for _, name := range strings.Split(list, ",") {
+		source, ok := mixerSources[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return fmt.Errorf("Unknown sound source '%s'", name)
+		}
+		mixer.Mute[source] = true
+	}
+
+	return nil
+}
+
+func configureMixer(mixer *device.Mixer, panning string, gain, beeperVolume, ayVolume, tapeVolume float64, mute string) error {
+	if err := mixer.ParsePanning(panning); err != nil {
+		return err
+	}
+	mixer.Gain = gain
+	mixer.Volume[device.MIXER_BEEPER] = beeperVolume
+	mixer.Volume[device.MIXER_AY_A] = ayVolume
+	mixer.Volume[device.MIXER_AY_B] = ayVolume
+	mixer.Volume[device.MIXER_AY_C] = ayVolume
+	mixer.Volume[device.MIXER_TAPE] = tapeVolume
+	return muteSources(mixer, mute)
+}
+
+// Reports invalid flags or failed startup and exits, like gumak_cli.
+func fatal(err error) {
+	log.Error("%s", err)
+	os.Exit(1)
+}
+
+// Plays song of AY music file without window, until its end (or until
+// interrupted when the length is unknown).
+func playMusic(p *player.Player, song int, freq, samples int, format host.SampleFormat) error {
+	if song > 0 {
+		if err := p.SelectSong(song - 1); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Playing %d/%d '%s' by '%s'", p.Song()+1, p.Songs(), p.SongName(), p.Author)
+
+	var mutex sync.Mutex
+	snd := new(host.Sound)
+	snd.Init(p, freq, samples, format, &mutex, nil)
+	snd.TurnOnOff(true)
+	defer snd.Destroy()
+
+	for {
+		time.Sleep(100 * time.Millisecond)
+
+		mutex.Lock()
+		finished := p.Finished()
+		mutex.Unlock()
+
+		if finished {
+			return nil
+		}
+	}
+}
+
 func main() {
 	// Flags.
 	var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	var filtering = flag.Int("filtering", 0, "upscale filtering (0=nearest, 1=linear, 2=best, 3=hq2x, 4=hq3x)")
 	var scale = flag.Float64("scale", 4, "screen scale multiplicator")
-	var machine = flag.String("machine", "128", "machine (48=48K, 128=128K)")
+	var palette = flag.String("palette", "default", "palette preset or file with 16 colours (see -palettes)")
+	var listPalettes = flag.Bool("palettes", false, "list palette presets")
+	var border = flag.String("border", "normal", "border size (normal=320x240, full=352x296)")
+	var machine = flag.String("machine", "128", "machine (see -machines)")
+	var listMachines = flag.Bool("machines", false, "list available machines")
+	var kempston = flag.Bool("kempston", false, "attach Kempston joystick (numeric keypad)")
+	var ulaPlus = flag.Bool("ulaplus", false, "attach ULAplus 64 colour palette")
+	var timex = flag.Bool("timex", false, "attach Timex screen modes (port 0xff)")
 	var sound = flag.Bool("sound", true, "turn on sound")
+	var freq = flag.Int("freq", 48000, "audio sample rate (e.g. 44100, 48000, 96000)")
+	var samples = flag.Int("samples", 512, "audio buffer size in frames")
+	var sampleFormat = flag.String("sampleformat", "f32", "audio sample format (f32, s16)")
 	var rom = flag.String("rom", "", "rom to load on startup")
+	var romDir = flag.String("romdir", "", "directory with machine ROM images (overrides embedded ROMs)")
+	var panning = flag.String("panning", "mono", "AY channel panning (mono, abc, acb, bac or custom a,b,c from 0=left to 1=right)")
+	var gain = flag.Float64("gain", 1, "master volume")
+	var beeperVolume = flag.Float64("beepervol", 1, "beeper volume (0-1)")
+	var ayVolume = flag.Float64("ayvol", 1, "AY volume (0-1)")
+	var tapeVolume = flag.Float64("tapevol", 1, "tape loading sound volume (0-1)")
+	var fastTape = flag.Bool("fasttape", true, "load tapes at full speed without sound")
+	var mute = flag.String("mute", "", "muted sound sources, comma separated (beeper, a, b, c, tape)")
+	var record = flag.String("record", "", "record video to file (.avi, or .y4m with .wav audio)")
+	var gifSeconds = flag.Float64("gifseconds", 10, "length of GIF capture (Pause key) in seconds")
+	var gifBorder = flag.Bool("gifborder", true, "include border in GIF capture")
+	var ayLogFormat = flag.String("aylogformat", "psg", "format of AY log (Scroll Lock key): psg, ym5, ym6")
+	var play = flag.String("play", "", "play AY music file (.ay, .psg, .ym) without the emulator")
+	var song = flag.Int("song", 0, "song of the AY music file (from 1, default first)")
+	var customRoms romFiles
+	flag.Var(&customRoms, "romfile", "custom ROM image as slot=path[@crc32], can be repeated")
 
 	flag.Parse()
 
+	if *listMachines {
+		for _, m := range gumak.Machines() {
+			fmt.Printf("%-10s %s\n", m.Name, m.Description)
+		}
+		return
+	}
+
+	if *listPalettes {
+		for _, p := range gumak.Palettes() {
+			fmt.Println(p)
+		}
+		return
+	}
+
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -30,20 +191,104 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	iw, ih := gumak.InnerResolution()
-	ow, oh := gumak.OuterResolution()
+	var ayFormat gumak.AyLogFormat
+	switch *ayLogFormat {
+	case "psg":
+		ayFormat = gumak.AyLogPsg
+	case "ym5":
+		ayFormat = gumak.AyLogYm5
+	case "ym6":
+		ayFormat = gumak.AyLogYm6
+	default:
+		fatal(fmt.Errorf("Unknown AY log format: %s", *ayLogFormat))
+	}
+
+	format := host.SampleFloat32
+	switch *sampleFormat {
+	case "f32":
+	case "s16":
+		format = host.SampleInt16
+	default:
+		fatal(fmt.Errorf("Unknown sample format: %s", *sampleFormat))
+	}
+
+	if len(*play) > 0 {
+		p, err := player.Open(*play, *freq)
+		if err != nil {
+			fatal(err)
+		}
+		if err := configureMixer(p.Mixer, *panning, *gain, *beeperVolume, *ayVolume, *tapeVolume, *mute); err != nil {
+			fatal(err)
+		}
+		if err := playMusic(p, *song, *freq, *samples, format); err != nil {
+			fatal(err)
+		}
+		return
+	}
 
-	freq, samples := 41800, 512
+	model, ok := gumak.FindMachine(*machine)
+	if !ok {
+		fatal(fmt.Errorf("Unknown machine: %s", *machine))
+	}
 
-	gumak, err := gumak.CreateNew(*machine == "48", freq)
+	if *kempston {
+		model.Peripherals = append(model.Peripherals, gumak.PeripheralKempston)
+	}
+
+	if *ulaPlus {
+		model.Peripherals = append(model.Peripherals, gumak.PeripheralUlaPlus)
+	}
+
+	if *timex {
+		model.Peripherals = append(model.Peripherals, gumak.PeripheralTimex)
+	}
+
+	model.RomDir = *romDir
+	for _, value := range customRoms {
+		image, err := readRomFile(value)
+		if err != nil {
+			fatal(err)
+		}
+		model.RomImages = append(model.RomImages, image)
+	}
+
+	gumak, err := gumak.CreateMachine(model, *freq)
 	if err != nil {
-		panic(err)
+		fatal(err)
+	}
+
+	switch *border {
+	case "normal":
+	case "full":
+		if err := gumak.SetFrameResolution(352, 296); err != nil {
+			fatal(err)
+		}
+	default:
+		fatal(fmt.Errorf("Unknown border size: %s", *border))
+	}
+
+	if err := configureMixer(gumak.Mixer, *panning, *gain, *beeperVolume, *ayVolume, *tapeVolume, *mute); err != nil {
+		fatal(err)
+	}
+
+	gumak.FastTape = *fastTape
+
+	if err := gumak.SetPalette(*palette); err != nil {
+		if err := gumak.LoadPalette(*palette); err != nil {
+			fatal(err)
+		}
 	}
 
 	if len(*rom) > 0 {
 		err := gumak.LoadSnapshot(*rom, nil)
 		if err != nil {
-			panic(err)
+			fatal(err)
+		}
+	}
+
+	if len(*record) > 0 {
+		if err := gumak.StartRecording(*record); err != nil {
+			fatal(err)
 		}
 	}
 
@@ -51,11 +296,17 @@ func main() {
 
 	// Host platform
 	platform := new(host.Platform)
-	platform.Init(ow, oh, *scale)
+	// Frame contains the border.
+	fw, fh := gumak.FrameResolution()
+
+	platform.GifSeconds, platform.GifBorder = *gifSeconds, *gifBorder
+	platform.AyLogFormat = ayFormat
+	platform.Palette = *palette
+	platform.Init(fw, fh, *scale)
 	defer platform.Destroy()
 
-	gfx := platform.CreateGfx(host.Filtering(*filtering), iw, ih, ow, oh)
-	snd := platform.CreateSound(gumak, freq, samples)
+	gfx := platform.CreateGfx(host.Filtering(*filtering), fw, fh, fw, fh)
+	snd := platform.CreateSound(gumak, *freq, *samples, format)
 	snd.TurnOnOff(*sound)
 
 	for {
@@ -67,4 +318,15 @@ func main() {
 		platform.Update(gumak)
 		gfx.Draw(gumak)
 	}
+
+	// Audio callback drives the emulation, stop it before the recording.
+	snd.TurnOnOff(false)
+	if err := gumak.StopRecording(); err != nil {
+		log.Error("Error saving recording: %s", err)
+	}
+	gumak.StopGif()
+	gumak.StopAyLog()
+	if err := gumak.StopWav(); err != nil {
+		log.Error("Error saving WAV: %s", err)
+	}
 }